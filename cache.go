@@ -0,0 +1,51 @@
+package dnsconfig
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+var (
+	cacheMu    sync.Mutex
+	cachedConf *DnsConfig
+
+	readCachedConfig = func() *DnsConfig { return ReadDnsConfig() } // variable for testing
+)
+
+// CachedConfig returns the system DNS config, reading it on first use
+// and again only when the modification time of DefaultResolvFile
+// changes, unless the config sets NoReload. The returned config is
+// shared and must not be modified. It is safe for concurrent use.
+func CachedConfig() *DnsConfig {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if cachedConf == nil || cachedConf.ShouldReload() && cachedConf.fileChanged() {
+		cachedConf = readCachedConfig()
+	}
+	return cachedConf
+}
+
+// ShouldReload reports whether conf should be reread when its file
+// changes. It is false if the no-reload option was set.
+func (conf *DnsConfig) ShouldReload() bool {
+	return !conf.NoReload
+}
+
+// fileChanged reports whether DefaultResolvFile has been modified,
+// created or removed since conf was read from it.
+func (conf *DnsConfig) fileChanged() bool {
+	if DefaultResolvFile == "" || conf.Err == nil && conf.Mtime.IsZero() {
+		// Not read from a file.
+		return false
+	}
+	fi, err := os.Stat(DefaultResolvFile)
+	if err != nil {
+		// Changed if it existed when read, even if it could not be
+		// read then.
+		return !errors.Is(conf.Err, fs.ErrNotExist)
+	}
+	// A file that could not be read has the mtime it had then.
+	return !fi.ModTime().Equal(conf.Mtime)
+}
@@ -0,0 +1,116 @@
+//go:build !windows && !android
+
+package dnsconfig
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachedConfig(t *testing.T) {
+	unsetNdotsEnv(t)
+	origResolvFile := DefaultResolvFile
+	origReadCachedConfig := readCachedConfig
+	defer func() {
+		DefaultResolvFile = origResolvFile
+		readCachedConfig = origReadCachedConfig
+		cachedConf = nil
+	}()
+
+	DefaultResolvFile = t.TempDir() + "/resolv.conf"
+	if err := os.WriteFile(DefaultResolvFile, []byte("nameserver 8.8.8.8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var reads atomic.Int32
+	readCachedConfig = func() *DnsConfig {
+		reads.Add(1)
+		return ReadDnsConfig()
+	}
+	cachedConf = nil
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if conf := CachedConfig(); len(conf.Servers) != 1 || conf.Servers[0] != "8.8.8.8:53" {
+				t.Errorf("got servers %q", conf.Servers)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := reads.Load(); n != 1 {
+		t.Errorf("read config %d times; want 1", n)
+	}
+
+	mtime := time.Now().Add(time.Hour)
+	if err := os.WriteFile(DefaultResolvFile, []byte("nameserver 1.1.1.1\noptions no-reload\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(DefaultResolvFile, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if conf := CachedConfig(); conf.Servers[0] != "1.1.1.1:53" || reads.Load() != 2 {
+		t.Errorf("after modification: got servers %q after %d reads; want 1.1.1.1:53 after 2", conf.Servers, reads.Load())
+	}
+
+	mtime = mtime.Add(time.Hour)
+	if err := os.Chtimes(DefaultResolvFile, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	CachedConfig()
+	if n := reads.Load(); n != 2 {
+		t.Errorf("with no-reload: read config %d times; want 2", n)
+	}
+}
+
+func TestCachedConfigUnreadable(t *testing.T) {
+	unsetNdotsEnv(t)
+	origResolvFile := DefaultResolvFile
+	origReadCachedConfig := readCachedConfig
+	defer func() {
+		DefaultResolvFile = origResolvFile
+		readCachedConfig = origReadCachedConfig
+		cachedConf = nil
+	}()
+
+	// A socket exists but cannot be opened, even by root.
+	DefaultResolvFile = t.TempDir() + "/resolv.conf"
+	l, err := net.Listen("unix", DefaultResolvFile)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	var reads atomic.Int32
+	readCachedConfig = func() *DnsConfig {
+		reads.Add(1)
+		return ReadDnsConfig()
+	}
+	cachedConf = nil
+
+	for i := 0; i < 3; i++ {
+		if conf := CachedConfig(); conf.Err == nil || conf.Mtime.IsZero() {
+			t.Fatalf("got error %v, mtime %v; want an error and the file's mtime", conf.Err, conf.Mtime)
+		}
+	}
+	if n := reads.Load(); n != 1 {
+		t.Errorf("read unreadable config %d times; want 1", n)
+	}
+
+	// Removing it is a change.
+	l.Close()
+	os.Remove(DefaultResolvFile)
+	if conf := CachedConfig(); !errors.Is(conf.Err, fs.ErrNotExist) || reads.Load() != 2 {
+		t.Errorf("after removal: got error %v after %d reads; want %v after 2", conf.Err, reads.Load(), fs.ErrNotExist)
+	}
+	CachedConfig()
+	if n := reads.Load(); n != 2 {
+		t.Errorf("with the file still missing: read config %d times; want 2", n)
+	}
+}
@@ -1,12 +1,81 @@
+// Command dnsutil prints the system DNS config, or that of a given
+// resolv.conf file, and looks up names with it.
+//
+// Usage:
+//
+//	dnsutil [-file path] [-json] [-resolve name]
+//	dnsutil [-file path] query name
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/xjdrew/dnsconfig"
 )
 
 func main() {
-	conf := dnsconfig.ReadDnsConfig()
-	fmt.Printf("dnsconfig: %+v", conf)
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "dnsutil:", err)
+		os.Exit(2)
+	}
+}
+
+// jsonConfig is the JSON form of a config, with the error as a string.
+type jsonConfig struct {
+	*dnsconfig.DnsConfig
+	Err string `json:",omitempty"`
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("dnsutil", flag.ContinueOnError)
+	file := fs.String("file", "", "read the config from `path` instead of the system config")
+	asJSON := fs.Bool("json", false, "print the config as JSON")
+	resolve := fs.String("resolve", "", "print the names queried, in order, to look up `name`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	query := fs.NArg() > 0 && fs.Arg(0) == "query"
+	switch {
+	case query && fs.NArg() != 2:
+		return fmt.Errorf("usage: dnsutil [-file path] query name")
+	case !query && fs.NArg() > 0:
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	var opts []dnsconfig.Option
+	if *file != "" {
+		opts = append(opts, dnsconfig.WithFile(*file))
+	}
+	conf := dnsconfig.ReadDnsConfig(opts...)
+
+	switch {
+	case query:
+		addrs, err := conf.LookupHost(context.Background(), fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			fmt.Fprintln(stdout, addr)
+		}
+	case *resolve != "":
+		for _, c := range conf.NameListDetailed(*resolve) {
+			fmt.Fprintln(stdout, c.FQDN)
+		}
+	case *asJSON:
+		jc := jsonConfig{DnsConfig: conf}
+		if conf.Err != nil {
+			jc.Err = conf.Err.Error()
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(jc)
+	default:
+		fmt.Fprint(stdout, conf.Summary())
+	}
+	return nil
 }
@@ -0,0 +1,88 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xjdrew/dnsconfig"
+)
+
+func testFile(t *testing.T) string {
+	name := filepath.Join(t.TempDir(), "resolv.conf")
+	data := "nameserver 8.8.8.8\nsearch example.com corp.example.com\noptions ndots:2 rotate\n"
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRunFile(t *testing.T) {
+	t.Setenv(dnsconfig.NdotsEnv, "")
+	os.Unsetenv(dnsconfig.NdotsEnv)
+
+	var out strings.Builder
+	if err := run([]string{"-file", testFile(t)}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"8.8.8.8:53", "search: example.com. corp.example.com.", "ndots: 2", "options: rotate"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	t.Setenv(dnsconfig.NdotsEnv, "")
+	os.Unsetenv(dnsconfig.NdotsEnv)
+
+	var out strings.Builder
+	if err := run([]string{"-file", testFile(t), "-json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Servers []string
+		Search  []string
+		Ndots   int
+		Rotate  bool
+		Err     string
+	}
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatalf("%v:\n%s", err, out.String())
+	}
+	if len(got.Servers) != 1 || got.Servers[0] != "8.8.8.8:53" || got.Ndots != 2 || !got.Rotate || got.Err != "" {
+		t.Errorf("got %+v", got)
+	}
+
+	out.Reset()
+	if err := run([]string{"-file", filepath.Join(t.TempDir(), "missing"), "-json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil || got.Err == "" {
+		t.Errorf("missing file: got %+v, %v; want an error string", got, err)
+	}
+}
+
+func TestRunResolve(t *testing.T) {
+	var out strings.Builder
+	if err := run([]string{"-file", testFile(t), "-resolve", "host"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "host.example.com.\nhost.corp.example.com.\nhost.\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunBadArgs(t *testing.T) {
+	var out strings.Builder
+	for _, args := range [][]string{{"-bogus"}, {"extra"}, {"query"}, {"query", "a", "b"}} {
+		if err := run(args, &out); err == nil {
+			t.Errorf("run(%q) succeeded; want error", args)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package dnsconfig
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Diff returns a human-readable description of each setting that differs
+// between conf and other, such as "ndots: 1 -> 2". Mtime, Err and
+// Warnings are not compared, and ExtraOptions are compared regardless
+// of the order of differently named options. Diff returns nil if the
+// configs are equivalent.
+func (conf *DnsConfig) Diff(other *DnsConfig) []string {
+	var diffs []string
+	list := func(name string, a, b []string) {
+		if !slices.Equal(a, b) {
+			diffs = append(diffs, fmt.Sprintf("%s: %v -> %v", name, a, b))
+		}
+	}
+	value := func(name string, a, b any) {
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("%s: %v -> %v", name, a, b))
+		}
+	}
+	list("servers", conf.Servers, other.Servers)
+	list("dot-servers", conf.DoTServers, other.DoTServers)
+	list("unresolved-servers", conf.UnresolvedServers, other.UnresolvedServers)
+	list("search", conf.Search, other.Search)
+	value("ndots", conf.Ndots, other.Ndots)
+	value("timeout", conf.Timeout, other.Timeout)
+	value("attempts", conf.Attempts, other.Attempts)
+	value("max-search-tries", conf.MaxSearchTries, other.MaxSearchTries)
+	value("rotate", conf.Rotate, other.Rotate)
+	value("unknown-opt", conf.UnknownOpt, other.UnknownOpt)
+	list("extra-options", sortOptions(conf.ExtraOptions), sortOptions(other.ExtraOptions))
+	list("lookup", conf.Lookup, other.Lookup)
+	list("nsswitch", conf.NSSwitch, other.NSSwitch)
+	value("single-request", conf.SingleRequest, other.SingleRequest)
+	value("single-request-reopen", conf.SingleRequestReopen, other.SingleRequestReopen)
+	value("use-tcp", conf.UseTCP, other.UseTCP)
+	value("trust-ad", conf.TrustAD, other.TrustAD)
+	value("no-reload", conf.NoReload, other.NoReload)
+	value("insecure1", conf.Insecure1, other.Insecure1)
+	value("insecure2", conf.Insecure2, other.Insecure2)
+	value("no-tld-query", conf.NoTLDQuery, other.NoTLDQuery)
+	return diffs
+}
+
+// Equal reports whether conf and other are equivalent, that is, whether
+// Diff finds no differences between them.
+func (conf *DnsConfig) Equal(other *DnsConfig) bool {
+	return conf.Diff(other) == nil
+}
+
+// MatchesSystem reports whether conf is equivalent to the system DNS
+// config, as read now by ReadDnsConfig. It returns the error, if any,
+// from reading the system config.
+func (conf *DnsConfig) MatchesSystem() (bool, error) {
+	sys := ReadDnsConfig()
+	if sys.Err != nil {
+		return false, sys.Err
+	}
+	return conf.Equal(sys), nil
+}
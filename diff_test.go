@@ -0,0 +1,51 @@
+package dnsconfig
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	a := NewDefaultConfig()
+	a.Servers = []string{"8.8.8.8:53"}
+	a.Mtime = time.Now()
+
+	b := NewDefaultConfig()
+	b.Servers = []string{"1.1.1.1:53"}
+	b.Ndots = 2
+	b.Timeout = 10 * time.Second
+	b.Rotate = true
+
+	want := []string{
+		"servers: [8.8.8.8:53] -> [1.1.1.1:53]",
+		"ndots: 1 -> 2",
+		"timeout: 5s -> 10s",
+		"rotate: false -> true",
+	}
+	if got := a.Diff(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %q; want %q", got, want)
+	}
+
+	b = NewDefaultConfig()
+	b.Servers = []string{"8.8.8.8:53"}
+	if got := a.Diff(b); got != nil {
+		t.Errorf("Diff() of configs differing only in Mtime = %q; want nil", got)
+	}
+
+	a = NewDefaultConfig()
+	a.UnresolvedServers = []string{"a.example"}
+	b = NewDefaultConfig()
+	b.UnresolvedServers = []string{"b.example"}
+	b.MaxSearchTries = 2
+	want = []string{
+		"unresolved-servers: [a.example] -> [b.example]",
+		"max-search-tries: 0 -> 2",
+	}
+	if got := a.Diff(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %q; want %q", got, want)
+	}
+	if a.Equal(b) {
+		t.Error("configs with different unresolved servers are Equal")
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !windows && !android
+
+package dnsconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchesSystem(t *testing.T) {
+	defer func(s string) { DefaultResolvFile = s }(DefaultResolvFile)
+	DefaultResolvFile = filepath.Join(t.TempDir(), "resolv.conf")
+	unsetNdotsEnv(t)
+
+	conf := &DnsConfig{
+		Servers:  []string{"8.8.8.8:53", "[2001:4860:4860::8888]:53"},
+		Search:   []string{"example.com."},
+		Ndots:    2,
+		Timeout:  3 * time.Second,
+		Attempts: 2,
+		Rotate:   true,
+	}
+	if err := conf.WriteFileAtomic(DefaultResolvFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := conf.MatchesSystem(); !ok || err != nil {
+		t.Errorf("MatchesSystem() = %v, %v; want true, nil", ok, err)
+	}
+
+	conf.Ndots = 3
+	if ok, err := conf.MatchesSystem(); ok || err != nil {
+		t.Errorf("MatchesSystem() after change = %v, %v; want false, nil", ok, err)
+	}
+
+	os.Remove(DefaultResolvFile)
+	if ok, err := conf.MatchesSystem(); ok || err == nil {
+		t.Errorf("MatchesSystem() with no system config = %v, %v; want false and an error", ok, err)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsconfig
+
+// EnsureRooted returns s with a trailing dot, adding one if necessary.
+func EnsureRooted(s string) string {
+	return ensureRooted(s)
+}
+
+// IsDomainName reports whether s is a presentation-format domain name
+// that can be looked up in DNS, as checked by isDomainName.
+func IsDomainName(s string) bool {
+	return isDomainName(s)
+}
+
+// isDomainName checks if a string is a presentation-format domain name
+// (currently restricted to hostname-compatible "preferred name" LDH labels and
+// SRV-like "underscore labels"; see golang.org/issue/12421).
+func isDomainName(s string) bool {
+	// The root domain name is valid. See golang.org/issue/45715.
+	if s == "." {
+		return true
+	}
+
+	// See RFC 1035, RFC 3696.
+	// Presentation format has dots before every label except the first, and the
+	// terminal empty label is optional here because we assume fully-qualified
+	// (absolute) input. We must therefore reserve space for the first and last
+	// labels' length octets in wire format, where they are necessary and the
+	// maximum total length is 255.
+	// So our _effective_ maximum is 253, but 254 is not rejected if the last
+	// character is a dot.
+	l := len(s)
+	if l == 0 || l > 254 || l == 254 && s[l-1] != '.' {
+		return false
+	}
+
+	last := byte('.')
+	nonNumeric := false // true once we've seen a letter or hyphen
+	partlen := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		default:
+			return false
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_':
+			nonNumeric = true
+			partlen++
+		case '0' <= c && c <= '9':
+			// fine
+			partlen++
+		case c == '-':
+			// Byte before dash cannot be dot.
+			if last == '.' {
+				return false
+			}
+			partlen++
+			nonNumeric = true
+		case c == '.':
+			// Byte before dot cannot be dot, dash.
+			if last == '.' || last == '-' {
+				return false
+			}
+			if partlen > 63 || partlen == 0 {
+				return false
+			}
+			partlen = 0
+		}
+		last = c
+	}
+	if last == '-' || partlen > 63 {
+		return false
+	}
+
+	return nonNumeric
+}
+
+// avoidDNS reports whether this is a hostname for which we should not
+// use DNS. Currently this includes only .onion, per RFC 7686. See
+// golang.org/issue/13705. Does not cover .local names (RFC 6762),
+// see golang.org/issue/16739.
+func avoidDNS(name string) bool {
+	if name == "" {
+		return true
+	}
+	if name[len(name)-1] == '.' {
+		name = name[:len(name)-1]
+	}
+	return stringsHasSuffixFold(name, ".onion")
+}
+
+// nameList returns a list of names for sequential DNS queries.
+func (conf *DnsConfig) nameList(name string) []string {
+	candidates := conf.NameListDetailed(name)
+	if candidates == nil {
+		return nil
+	}
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.FQDN
+	}
+	return names
+}
+
+// NameListBatch returns the names to query for each of names, in the
+// order a lookup tries them, keyed by the name as given. Names for
+// which there is nothing to query, such as names too long to be valid,
+// are left out.
+func (conf *DnsConfig) NameListBatch(names []string) map[string][]string {
+	m := make(map[string][]string, len(names))
+	for _, name := range names {
+		if list := conf.nameList(name); len(list) > 0 {
+			m[name] = list
+		}
+	}
+	return m
+}
+
+// A NameCandidate is one of the names tried, in turn, to look up a name.
+type NameCandidate struct {
+	FQDN     string // rooted name to query
+	Suffixed bool   // whether FQDN has a search domain appended
+}
+
+// NameListDetailed returns the names to query for name in the order a
+// lookup tries them, noting which have a search domain appended.
+func (conf *DnsConfig) NameListDetailed(name string) []NameCandidate {
+	// Check name length (see isDomainName).
+	l := len(name)
+	rooted := l > 0 && name[l-1] == '.'
+	if l > 254 || l == 254 && !rooted {
+		return nil
+	}
+
+	// If name is rooted (trailing dot), try only that name.
+	if rooted {
+		if avoidDNS(name) {
+			return nil
+		}
+		return []NameCandidate{{FQDN: name}}
+	}
+
+	hasNdots := conf.IsAbsolute(name)
+	name += "."
+	l++
+
+	// Build list of search choices.
+	names := make([]NameCandidate, 0, 1+len(conf.searchTries()))
+	// If name has enough dots, try unsuffixed first.
+	if hasNdots && !avoidDNS(name) {
+		names = append(names, NameCandidate{FQDN: name})
+	}
+	// Try suffixes that are not too long (see isDomainName).
+	for _, suffix := range conf.searchTries() {
+		fqdn := name + suffix
+		if !avoidDNS(fqdn) && len(fqdn) <= 254 {
+			names = append(names, NameCandidate{FQDN: fqdn, Suffixed: true})
+		}
+	}
+	// Try unsuffixed, if not tried first above.
+	if !hasNdots && !avoidDNS(name) {
+		names = append(names, NameCandidate{FQDN: name})
+	}
+	return names
+}
+
+// SearchSuffixes returns the rooted suffixes nameList appends, in order,
+// to a non-rooted name with fewer than Ndots dots. The final entry is
+// the root "." standing for the name itself.
+func (conf *DnsConfig) SearchSuffixes() []string {
+	search := conf.searchTries()
+	suffixes := make([]string, 0, 1+len(search))
+	suffixes = append(suffixes, search...)
+	return append(suffixes, ".")
+}
+
+// searchTries returns the prefix of Search allowed by MaxSearchTries.
+func (conf *DnsConfig) searchTries() []string {
+	if conf.MaxSearchTries > 0 && conf.MaxSearchTries < len(conf.Search) {
+		return conf.Search[:conf.MaxSearchTries]
+	}
+	return conf.Search
+}
@@ -0,0 +1,67 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var isDomainNameTests = []struct {
+	name string
+	want bool
+}{
+	{"", false},
+	{".", true},
+	{"example.com", true},
+	{"example.com.", true},
+	{"example..com", false},
+	{".example.com", false},
+	{"-example.com", false},
+	{"example-.com", false},
+	{"_sip._tcp.example.com", true},
+	{"127.0.0.1", false},
+	{strings.Repeat("a", 63) + ".com", true},
+	{strings.Repeat("a", 64) + ".com", false},
+	{strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 61), true},
+	{strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 62), false},
+	{strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 61) + ".", true},
+}
+
+func TestIsDomainName(t *testing.T) {
+	for _, tt := range isDomainNameTests {
+		if got := IsDomainName(tt.name); got != tt.want {
+			t.Errorf("IsDomainName(%q) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnsureRooted(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"", "."},
+		{".", "."},
+		{"example.com", "example.com."},
+		{"example.com.", "example.com."},
+	} {
+		if got := EnsureRooted(tt.in); got != tt.want {
+			t.Errorf("EnsureRooted(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNameListBatch(t *testing.T) {
+	conf := &DnsConfig{Ndots: 1, Search: []string{"example.com."}}
+	long := strings.Repeat("a", 254)
+	got := conf.NameListBatch([]string{"host", "www.example.org", "rooted.example.", long, "x.onion.", "host"})
+	want := map[string][]string{
+		"host":            {"host.example.com.", "host."},
+		"www.example.org": {"www.example.org.", "www.example.org.example.com."},
+		"rooted.example.": {"rooted.example."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NameListBatch() = %q; want %q", got, want)
+	}
+}
@@ -5,31 +5,614 @@
 package dnsconfig
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	defaultNS = []string{"127.0.0.1:53", "[::1]:53"}
+
+	// DefaultSearchWalksParents makes the hostname-derived default search
+	// list contain every parent domain of the host down to, but not
+	// including, the top-level domain, as classic BIND resolvers did.
+	DefaultSearchWalksParents = false
+
+	// DefaultPort is the port given to name servers listed without
+	// one, as resolv.conf has no syntax for a port. A local forwarder
+	// on another port can be used by changing it.
+	DefaultPort = "53"
+
+	// NdotsEnv names the environment variable that, when set to a number,
+	// overrides the ndots option of the system config read by
+	// ReadDnsConfig. Configs parsed from other sources ignore it.
+	NdotsEnv = "NDOTS"
+
+	hostnameMu  sync.Mutex    // guards getHostname against SetHostnameFunc
+	getHostname = os.Hostname // variable for testing
+
+	// serverSeed offsets the rotation in NextServer so that processes
+	// sharing a config spread their queries across the servers.
+	serverSeed = uint32(os.Getpid()) // variable for testing
 )
 
+// A Libc identifies a C library resolver whose handling of resolv.conf
+// is followed where the implementations disagree.
+type Libc int
+
+const (
+	Glibc Libc = iota // GNU C library
+	Musl              // musl libc
+	BSD               // BSD libc
+)
+
+// LibcFlavor is the C library resolver to follow when reading config
+// options whose handling differs between implementations.
+var LibcFlavor = Glibc
+
+// The range of the ndots option, as glibc's RES_MAXNDOTS. Values
+// outside it are clamped.
+const (
+	MinNdots = 0
+	MaxNdots = 15
+)
+
+// maxDNSSearch is the maximum number of search domains, as glibc's MAXDNSRCH.
+const maxDNSSearch = 6
+
+// minAttemptTimeout is the shortest wait PerAttemptTimeout returns.
+const minAttemptTimeout = 100 * time.Millisecond
+
 type DnsConfig struct {
-	Servers    []string      // server addresses (in host:port form) to use
-	Search     []string      // rooted suffixes to append to local name
-	Ndots      int           // number of dots in name to trigger absolute lookup
-	Timeout    time.Duration // wait before giving up on a query, including retries
-	Attempts   int           // lost packets before giving up on server
-	Rotate     bool          // round robin among servers
-	UnknownOpt bool          // anything unknown was encountered
-	Lookup     []string      // OpenBSD top-level database "lookup" order
-	Err        error         // any error that occurs during open of resolv.conf
-	Mtime      time.Time     // time of resolv.conf modification
-
-	SingleRequest bool // use sequential A and AAAA queries instead of parallel queries
-	UseTCP        bool // force usage of TCP for DNS resolutions
-	TrustAD       bool // add AD flag to queries
-	NoReload      bool // do not check for config file updates
-}
-
-func ReadDnsConfig() *DnsConfig {
-	return dnsReadDefaultConfig()
+	Servers           []string          // server addresses (in host:port form) to use
+	AllServers        []string          // every server address read, repeats included; Servers holds the distinct ones kept by the MaxServers limit
+	DoTServers        []string          // DNS-over-TLS servers (in host:port#servername form) to use
+	UnresolvedServers []string          // nameserver host names, not looked up, if AllowHostnameServers is set
+	Search            []string          // rooted suffixes to append to local name
+	MaxSearchTries    int               // most Search suffixes to try for a name, or 0 for all
+	Ndots             int               // number of dots in name to trigger absolute lookup
+	Timeout           time.Duration     // wait before giving up on a query, including retries
+	Attempts          int               // lost packets before giving up on server
+	Rotate            bool              // round robin among servers
+	UnknownOpt        bool              // anything unknown was encountered
+	ExtraOptions      []string          // unrecognized "options" tokens, verbatim
+	ExtraOptionValues map[string]string // unrecognized "options" tokens of the form key:value
+	Lookup            []string          // OpenBSD top-level database "lookup" order
+	NSSwitch          []string          // sources on the nsswitch.conf hosts line, if read with WithNSSwitch
+	Err               error             // any error that occurs during open of resolv.conf
+	Mtime             time.Time         // time of resolv.conf modification
+	ResolvedPath      string            // path of the file read, after following symbolic links
+	Warnings          []string          // non-fatal problems encountered while reading the config
+
+	SingleRequest       bool // use sequential A and AAAA queries instead of parallel queries
+	SingleRequestReopen bool // like SingleRequest, but use a new socket for the second query
+	UseTCP              bool // force usage of TCP for DNS resolutions
+	TrustAD             bool // add AD flag to queries
+	NoReload            bool // do not check for config file updates
+	Insecure1           bool // FreeBSD: do not require the reply to come from the queried server
+	Insecure2           bool // FreeBSD: do not require the reply to contain the original query
+	NoTLDQuery          bool // do not look up unqualified names as top-level domains
+
+	soffset         uint32 // used by NextServer
+	fallbackServers bool   // Servers is defaultNS, as none were configured
+}
+
+// DefaultConfig returns the config used when the system config cannot
+// be read: the default servers and options, with a search list derived
+// from the hostname.
+func DefaultConfig() *DnsConfig {
+	conf := defaultConfig()
+	conf.Servers = slices.Clone(conf.Servers)
+	conf.AllServers = slices.Clone(conf.AllServers)
+	return conf
+}
+
+func defaultConfig() *DnsConfig {
+	conf := newConfig()
+	conf.setDefaults()
+	return conf
+}
+
+// newConfig returns a config with the default options but no servers
+// or search list, for a reader to fill in.
+func newConfig() *DnsConfig {
+	return &DnsConfig{
+		Ndots:    1,
+		Timeout:  5 * time.Second,
+		Attempts: 2,
+	}
+}
+
+// setDefaults gives conf the default servers if it has none, and the
+// search list derived from the hostname if it has no search list. An
+// explicitly empty search list, as set by "search .", is kept as is.
+func (conf *DnsConfig) setDefaults() {
+	if len(conf.Servers) == 0 {
+		conf.Servers = defaultNS
+		conf.AllServers = defaultNS
+		conf.fallbackServers = true
+	}
+	if conf.Search == nil {
+		conf.Search = dnsDefaultSearch()
+	}
+}
+
+// NewDefaultConfig returns the config the parser produces for an empty
+// resolv.conf on a host whose name has no domain: the default servers
+// and options with a nil Search, which is not derived from the hostname.
+func NewDefaultConfig() *DnsConfig {
+	conf := DefaultConfig()
+	conf.Search = nil
+	return conf
+}
+
+// ReadDnsConfig reads the system DNS config, as modified by opts.
+func ReadDnsConfig(opts ...Option) *DnsConfig {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return dnsReadDefaultConfig(o)
+}
+
+// ReadDnsConfigContext is like ReadDnsConfig, but gives up when ctx is
+// done, returning the default config with Err set to ctx.Err(). Reading
+// the config on Windows queries every network adapter, which can be slow.
+func ReadDnsConfigContext(ctx context.Context, opts ...Option) *DnsConfig {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := ctx.Err(); err != nil {
+		conf := defaultConfig()
+		conf.Err = err
+		return conf
+	}
+	o.ctx = ctx
+	return dnsReadDefaultConfig(o)
+}
+
+// Stats holds counters gathered while reading the DNS config.
+type Stats struct {
+	FileExisted    bool // the config file was present, even if unreadable
+	ServersFound   int  // name servers accepted
+	ServersSkipped int  // name servers dropped as invalid or over the limit
+	SearchCount    int  // entries in the resulting search list
+	UnknownOptions int  // unrecognized directives and options
+}
+
+// ReadDnsConfigWithStats is like ReadDnsConfig but also returns
+// counters describing what was read.
+func ReadDnsConfigWithStats(opts ...Option) (*DnsConfig, *Stats) {
+	stats := new(Stats)
+	conf := ReadDnsConfig(append(slices.Clip(opts), func(o *options) { o.stats = stats })...)
+	return conf, stats
+}
+
+// SetHostnameFunc sets the function used to look up the local hostname
+// when deriving the default search list. A nil f restores os.Hostname.
+// It is safe to call while configs are being read.
+func SetHostnameFunc(f func() (string, error)) {
+	if f == nil {
+		f = os.Hostname
+	}
+	hostnameMu.Lock()
+	getHostname = f
+	hostnameMu.Unlock()
+}
+
+// applyEnvNdots overrides conf.Ndots with the value of the NdotsEnv
+// environment variable, if set. An empty value counts as unset, as in
+// glibc. A non-numeric value is reported in conf.Warnings and leaves
+// conf.Ndots unchanged.
+func (conf *DnsConfig) applyEnvNdots() {
+	s := os.Getenv(NdotsEnv)
+	if s == "" {
+		return
+	}
+	n, i, ok := dtoi(s)
+	if !ok || i != len(s) {
+		conf.Warnings = append(conf.Warnings, "invalid "+NdotsEnv+" environment value "+strconv.Quote(s))
+		return
+	}
+	conf.Ndots = clampNdots(n)
+}
+
+// clampNdots limits n to the range MinNdots to MaxNdots that the C
+// libraries accept. The BSD resolvers store ndots in a 4-bit field, so
+// a negative ndots keeps its low four bits rather than being raised to
+// MinNdots: -1 becomes 15.
+func clampNdots(n int) int {
+	if n < MinNdots {
+		if LibcFlavor == BSD {
+			return n & 0xf
+		}
+		return MinNdots
+	} else if n > MaxNdots {
+		return MaxNdots
+	}
+	return n
+}
+
+func dnsDefaultSearch() []string {
+	hostnameMu.Lock()
+	hostname := getHostname
+	hostnameMu.Unlock()
+	hn, err := hostname()
+	if err != nil {
+		// best effort
+		return nil
+	}
+	i := strings.IndexByte(hn, '.')
+	if i < 0 || i == len(hn)-1 {
+		return nil
+	}
+	domain := hn[i+1:]
+	if !DefaultSearchWalksParents {
+		return []string{ensureRooted(domain)}
+	}
+	var search []string
+	for len(search) < maxDNSSearch {
+		search = append(search, ensureRooted(domain))
+		i := strings.IndexByte(domain, '.')
+		if i < 0 || !strings.Contains(strings.TrimSuffix(domain[i+1:], "."), ".") {
+			// The parent is a top-level domain.
+			break
+		}
+		domain = domain[i+1:]
+	}
+	return search
+}
+
+func ensureRooted(s string) string {
+	if len(s) > 0 && s[len(s)-1] == '.' {
+		return s
+	}
+	return s + "."
+}
+
+// AppendSearch appends domains to the search list, rooting each one and
+// skipping the root and duplicates. Domains beyond the six-entry limit
+// are dropped.
+func (conf *DnsConfig) AppendSearch(domains ...string) {
+	search := slices.Clip(conf.Search)
+	for _, d := range domains {
+		d = ensureRooted(d)
+		if d == "." || slices.Contains(search, d) {
+			continue
+		}
+		if len(search) == maxDNSSearch {
+			break
+		}
+		search = append(search, d)
+	}
+	conf.Search = search
+}
+
+// SetServers replaces Servers with addrs. Each address must be an IP
+// address, optionally in host:port form; DefaultPort is used when none
+// is given. Servers is left unchanged if any address is invalid.
+func (conf *DnsConfig) SetServers(addrs ...string) error {
+	servers := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		s, err := normalizeServer(a)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, s)
+	}
+	conf.Servers = servers
+	conf.AllServers = servers
+	conf.fallbackServers = false
+	return nil
+}
+
+// ApplyEnvServers puts the servers listed in the environment variable
+// envKey, separated by commas or spaces, ahead of those already in
+// Servers, as sidecars that set a variable such as DNS_SERVERS expect.
+// Addresses are accepted in the forms SetServers takes. A server that is
+// listed twice is kept only in its first place, and invalid entries are
+// noted in Warnings and skipped. If the config listed no servers, the
+// loopback fallback in Servers is replaced rather than kept.
+func (conf *DnsConfig) ApplyEnvServers(envKey string) {
+	list := strings.FieldsFunc(os.Getenv(envKey), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	var env []string
+	for _, a := range list {
+		s, err := normalizeServer(a)
+		if err != nil {
+			conf.Warnings = append(conf.Warnings, "invalid "+envKey+" environment server "+strconv.Quote(a))
+			continue
+		}
+		if !slices.Contains(env, s) {
+			env = append(env, s)
+		}
+	}
+	if len(env) == 0 {
+		return
+	}
+	if conf.fallbackServers {
+		// The loopback fallback stands in for servers the config did
+		// not list, so the environment replaces it.
+		conf.Servers = env
+		conf.AllServers = env
+		conf.fallbackServers = false
+		return
+	}
+	prepend := func(servers []string) []string {
+		merged := slices.Clip(env)
+		for _, s := range servers {
+			if !slices.Contains(env, s) {
+				merged = append(merged, s)
+			}
+		}
+		return merged
+	}
+	conf.Servers = prepend(conf.Servers)
+	conf.AllServers = prepend(conf.AllServers)
+	conf.fallbackServers = false
+}
+
+// normalizeServer returns addr in host:port form.
+func normalizeServer(addr string) (string, error) {
+	if ip, err := netip.ParseAddr(addr); err == nil {
+		return net.JoinHostPort(ip.String(), DefaultPort), nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("dnsconfig: invalid server address %q", addr)
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return "", fmt.Errorf("dnsconfig: invalid server address %q", addr)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", fmt.Errorf("dnsconfig: invalid port in server address %q", addr)
+	}
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+// A flagOption is a boolean option of a DnsConfig.
+type flagOption struct {
+	name string // as written in resolv.conf
+	on   *bool
+}
+
+// flags returns the boolean options of conf.
+func (conf *DnsConfig) flags() []flagOption {
+	return []flagOption{
+		{"rotate", &conf.Rotate},
+		{"single-request", &conf.SingleRequest},
+		{"single-request-reopen", &conf.SingleRequestReopen},
+		{"use-vc", &conf.UseTCP},
+		{"trust-ad", &conf.TrustAD},
+		{"no-reload", &conf.NoReload},
+		{"insecure1", &conf.Insecure1},
+		{"insecure2", &conf.Insecure2},
+		{"no-tld-query", &conf.NoTLDQuery},
+	}
+}
+
+// Options returns the boolean options that are set, such as "rotate"
+// and "use-vc", by their names in resolv.conf.
+func (conf *DnsConfig) Options() map[string]bool {
+	m := make(map[string]bool)
+	for _, f := range conf.flags() {
+		if *f.on {
+			m[f.name] = true
+		}
+	}
+	return m
+}
+
+// SetOption sets or clears the boolean option with the given name, as
+// returned by Options. It returns an error for any other name.
+func (conf *DnsConfig) SetOption(name string, on bool) error {
+	for _, f := range conf.flags() {
+		if f.name == name {
+			*f.on = on
+			return nil
+		}
+	}
+	return fmt.Errorf("dnsconfig: unknown option %q", name)
+}
+
+// ServerCount returns the number of servers in Servers.
+func (conf *DnsConfig) ServerCount() int {
+	return len(conf.Servers)
+}
+
+// HasServers reports whether name servers were configured, rather than
+// Servers holding the local fallback used when there are none.
+func (conf *DnsConfig) HasServers() bool {
+	return len(conf.Servers) > 0 && !conf.fallbackServers
+}
+
+// PrimarySearch returns the first search domain and whether there is one.
+func (conf *DnsConfig) PrimarySearch() (string, bool) {
+	if len(conf.Search) == 0 {
+		return "", false
+	}
+	return conf.Search[0], true
+}
+
+// ADFlag reports whether queries should set the AD (authentic data) bit,
+// asking the server to report whether it validated the answer with
+// DNSSEC. It is set by the trust-ad option, which should only be used
+// when the path to the servers is trusted, as the answer is not
+// validated locally.
+func (conf *DnsConfig) ADFlag() bool {
+	return conf.TrustAD
+}
+
+// PerAttemptTimeout returns how long to wait for each attempt at a
+// query: Timeout spread evenly over Attempts, since Timeout covers
+// retries too. It is never less than minAttemptTimeout, so a long
+// attempts option with a short timeout still gives servers a chance
+// to answer.
+func (conf *DnsConfig) PerAttemptTimeout() time.Duration {
+	d := conf.Timeout
+	if conf.Attempts > 1 {
+		d /= time.Duration(conf.Attempts)
+	}
+	return max(d, minAttemptTimeout)
+}
+
+// Age returns how long ago the config file was last modified, or zero
+// if Mtime is unknown.
+func (conf *DnsConfig) Age() time.Duration {
+	if conf.Mtime.IsZero() {
+		return 0
+	}
+	return time.Since(conf.Mtime)
+}
+
+// IsStale reports whether the config file was last modified more than
+// maxAge ago. A config with no Mtime is never stale.
+func (conf *DnsConfig) IsStale(maxAge time.Duration) bool {
+	return conf.Age() > maxAge
+}
+
+// NextServer returns the server the next query should start with. It is
+// always the first server unless Rotate is set, in which case successive
+// calls cycle through Servers from a per-process starting point. It is
+// safe for concurrent use.
+func (conf *DnsConfig) NextServer() string {
+	if len(conf.Servers) == 0 {
+		return ""
+	}
+	if !conf.Rotate {
+		return conf.Servers[0]
+	}
+	n := atomic.AddUint32(&conf.soffset, 1) - 1
+	return conf.Servers[(serverSeed+n)%uint32(len(conf.Servers))]
+}
+
+// ServerURIs returns Servers as URIs of the form "udp://host:port", or
+// "tcp://host:port" if UseTCP is set. DNS-over-TLS and DNS-over-HTTPS
+// schemes are never produced; DoTServers are not included.
+func (conf *DnsConfig) ServerURIs() []string {
+	scheme := "udp://"
+	if conf.UseTCP {
+		scheme = "tcp://"
+	}
+	uris := make([]string, len(conf.Servers))
+	for i, s := range conf.Servers {
+		uris[i] = scheme + s
+	}
+	return uris
+}
+
+// A Transport is a protocol for sending DNS queries to a server.
+type Transport int
+
+const (
+	TransportUDP Transport = iota // plain DNS over UDP
+	TransportTCP                  // plain DNS over TCP
+	TransportDoT                  // DNS over TLS
+	TransportDoH                  // DNS over HTTPS
+)
+
+// ServersForTransport returns the servers that can be queried over t:
+// Servers for UDP and TCP, and DoTServers for DNS over TLS. No servers
+// are configured for DNS over HTTPS, so it returns nil for TransportDoH.
+func (conf *DnsConfig) ServersForTransport(t Transport) []string {
+	switch t {
+	case TransportUDP, TransportTCP:
+		return conf.Servers
+	case TransportDoT:
+		return conf.DoTServers
+	}
+	return nil
+}
+
+// IsAbsolute reports whether name is looked up as is before any search
+// suffixes are tried: that is, whether it is rooted or has at least
+// Ndots dots.
+func (conf *DnsConfig) IsAbsolute(name string) bool {
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		return true
+	}
+	return strings.Count(name, ".") >= conf.Ndots
+}
+
+// IPv4Servers returns the entries of Servers whose host is an IPv4 address.
+func (conf *DnsConfig) IPv4Servers() []string {
+	return conf.filterServers(netip.Addr.Is4)
+}
+
+// IPv6Servers returns the entries of Servers whose host is an IPv6 address.
+func (conf *DnsConfig) IPv6Servers() []string {
+	return conf.filterServers(netip.Addr.Is6)
+}
+
+// UsableServers returns the entries of Servers that a query can be sent
+// to, leaving out unspecified addresses such as 0.0.0.0 and "::" and
+// multicast addresses.
+func (conf *DnsConfig) UsableServers() []string {
+	return conf.filterServers(func(ip netip.Addr) bool {
+		ip = ip.Unmap()
+		return !ip.IsUnspecified() && !ip.IsMulticast()
+	})
+}
+
+// IsLoopbackOnly reports whether Servers is non-empty and every entry
+// is a loopback address, such as a local stub resolver.
+func (conf *DnsConfig) IsLoopbackOnly() bool {
+	return len(conf.Servers) > 0 && len(conf.filterServers(netip.Addr.IsLoopback)) == len(conf.Servers)
+}
+
+// IsSystemdResolvedStub reports whether Servers is non-empty and lists
+// only the systemd-resolved stub resolver, 127.0.0.53, and its proxy
+// stub, 127.0.0.54.
+func (conf *DnsConfig) IsSystemdResolvedStub() bool {
+	return len(conf.Servers) > 0 && len(conf.filterServers(isResolvedStub)) == len(conf.Servers)
+}
+
+var (
+	resolvedStub      = netip.AddrFrom4([4]byte{127, 0, 0, 53})
+	resolvedProxyStub = netip.AddrFrom4([4]byte{127, 0, 0, 54})
+)
+
+func isResolvedStub(ip netip.Addr) bool {
+	return ip == resolvedStub || ip == resolvedProxyStub
+}
+
+// StubResolvers returns the entries of Servers that are local stub
+// resolvers: the systemd-resolved stubs, and 127.0.0.1 and ::1, where
+// resolvers such as dnsmasq and unbound listen. Other loopback
+// addresses are not included.
+func (conf *DnsConfig) StubResolvers() []string {
+	return conf.filterServers(func(ip netip.Addr) bool {
+		return isResolvedStub(ip) || ip == netip.AddrFrom4([4]byte{127, 0, 0, 1}) || ip == netip.IPv6Loopback()
+	})
+}
+
+// filterServers returns the entries of Servers whose host parses as an
+// IP address satisfying match. Entries that fail to parse are dropped.
+func (conf *DnsConfig) filterServers(match func(netip.Addr) bool) []string {
+	var servers []string
+	for _, s := range conf.Servers {
+		host, _, err := net.SplitHostPort(s)
+		if err != nil {
+			continue
+		}
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			continue
+		}
+		if match(ip) {
+			servers = append(servers, s)
+		}
+	}
+	return servers
 }
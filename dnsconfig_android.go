@@ -0,0 +1,50 @@
+// Read system DNS config from Android system properties
+
+package dnsconfig
+
+import (
+	"net"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// getSystemProperty returns the value of the named Android system
+// property, or "" if it is unset or cannot be read.
+var getSystemProperty = func(name string) string { // variable for testing
+	out, err := exec.Command("/system/bin/getprop", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Android has no usable /etc/resolv.conf; the name servers are published
+// in the net.dns1 to net.dns4 system properties instead.
+func dnsReadDefaultConfig(o *options) *DnsConfig {
+	if o.file != "" {
+		conf := readConfig(o.file, o)
+		if o.envOverrides {
+			conf.applyEnvNdots()
+		}
+		return conf
+	}
+	maxServers := o.maxServers
+	if maxServers <= 0 {
+		maxServers = 4
+	}
+	conf := newConfig()
+	for i := 1; i <= 4; i++ {
+		s := getSystemProperty("net.dns" + strconv.Itoa(i))
+		if ip, err := netip.ParseAddr(s); err == nil {
+			conf.AllServers = append(conf.AllServers, net.JoinHostPort(ip.String(), DefaultPort))
+		}
+	}
+	conf.Servers = distinctServers(conf.AllServers, maxServers)
+	conf.setDefaults()
+	if o.envOverrides {
+		conf.applyEnvNdots()
+	}
+	return conf
+}
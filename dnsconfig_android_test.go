@@ -0,0 +1,28 @@
+package dnsconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDNSReadAndroidProperties(t *testing.T) {
+	unsetNdotsEnv(t)
+	origGetSystemProperty := getSystemProperty
+	defer func() { getSystemProperty = origGetSystemProperty }()
+
+	props := map[string]string{
+		"net.dns1": "8.8.8.8",
+		"net.dns2": "2001:4860:4860::8888",
+	}
+	getSystemProperty = func(name string) string { return props[name] }
+	conf := dnsReadDefaultConfig(defaultOptions())
+	if want := []string{"8.8.8.8:53", "[2001:4860:4860::8888]:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+
+	props = nil
+	conf = dnsReadDefaultConfig(defaultOptions())
+	if !reflect.DeepEqual(conf.Servers, defaultNS) {
+		t.Errorf("got servers %q; want %q", conf.Servers, defaultNS)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows && !android
+
+package dnsconfig
+
+func dnsReadDefaultConfig(o *options) *DnsConfig {
+	filename := o.file
+	if filename == "" {
+		filename = DefaultResolvFile
+	}
+	conf := readConfig(filename, o)
+	if o.envOverrides {
+		conf.applyEnvNdots()
+	}
+	return conf
+}
@@ -0,0 +1,433 @@
+package dnsconfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// unsetNdotsEnv unsets NdotsEnv for the duration of the test, so that
+// the system config read by ReadDnsConfig is not overridden.
+func unsetNdotsEnv(t *testing.T) {
+	t.Setenv(NdotsEnv, "")
+	os.Unsetenv(NdotsEnv)
+}
+
+func TestServersByFamily(t *testing.T) {
+	conf := &DnsConfig{
+		Servers: []string{
+			"8.8.8.8:53",
+			"[2001:4860:4860::8888]:53",
+			"[fe80::1%lo0]:53",
+			"10.0.0.1:5353",
+			"dns.example:53",
+			"8.8.4.4",
+		},
+	}
+	if got, want := conf.IPv4Servers(), []string{"8.8.8.8:53", "10.0.0.1:5353"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IPv4Servers() = %q; want %q", got, want)
+	}
+	if got, want := conf.IPv6Servers(), []string{"[2001:4860:4860::8888]:53", "[fe80::1%lo0]:53"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IPv6Servers() = %q; want %q", got, want)
+	}
+}
+
+func TestSetHostnameFunc(t *testing.T) {
+	defer SetHostnameFunc(nil)
+
+	SetHostnameFunc(func() (string, error) { return "host.example.com", nil })
+	if got, want := dnsDefaultSearch(), []string{"example.com."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dnsDefaultSearch() = %q; want %q", got, want)
+	}
+
+	SetHostnameFunc(nil)
+	got, err := getHostname()
+	want, wantErr := os.Hostname()
+	if got != want || err != wantErr {
+		t.Errorf("getHostname() after reset = %q, %v; want %q, %v", got, err, want, wantErr)
+	}
+
+	// Setting the function races with no reader, as the race
+	// detector checks.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			dnsDefaultSearch()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		SetHostnameFunc(func() (string, error) { return "host.example.com", nil })
+	}
+	wg.Wait()
+}
+
+func TestAppendSearch(t *testing.T) {
+	search := make([]string, 1, 8)
+	search[0] = "a.example."
+	conf := &DnsConfig{Search: search}
+	conf.AppendSearch("b.example", "a.example", ".", "b.example.", "c", "d", "e", "f", "g")
+	want := []string{"a.example.", "b.example.", "c.", "d.", "e.", "f."}
+	if !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("Search = %q; want %q", conf.Search, want)
+	}
+	if search[:2][1] != "" {
+		t.Errorf("AppendSearch wrote into the original backing array: %q", search[:2])
+	}
+}
+
+func TestSetServers(t *testing.T) {
+	conf := &DnsConfig{}
+	if err := conf.SetServers("8.8.8.8", "1.1.1.1:5353", "2001:4860:4860::8888", "[::1]:53"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"8.8.8.8:53", "1.1.1.1:5353", "[2001:4860:4860::8888]:53", "[::1]:53"}
+	if !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("Servers = %q; want %q", conf.Servers, want)
+	}
+
+	for _, addr := range []string{"dns.example", "dns.example:53", "8.8.8.8:0", "8.8.8.8:dns", "[::1]", ""} {
+		if err := conf.SetServers("9.9.9.9", addr); err == nil {
+			t.Errorf("SetServers(%q) succeeded; want error", addr)
+		}
+		if !reflect.DeepEqual(conf.Servers, want) {
+			t.Errorf("SetServers(%q) modified Servers to %q", addr, conf.Servers)
+		}
+	}
+}
+
+func TestPrimarySearch(t *testing.T) {
+	conf := &DnsConfig{Search: []string{"a.example.", "b.example."}}
+	if got, ok := conf.PrimarySearch(); got != "a.example." || !ok {
+		t.Errorf("PrimarySearch() = %q, %v; want %q, true", got, ok, "a.example.")
+	}
+	conf.Search = nil
+	if got, ok := conf.PrimarySearch(); got != "" || ok {
+		t.Errorf("PrimarySearch() with no search = %q, %v; want \"\", false", got, ok)
+	}
+}
+
+func TestIsLoopbackOnly(t *testing.T) {
+	tests := []struct {
+		servers []string
+		want    bool
+	}{
+		{[]string{"127.0.0.1:53", "[::1]:53"}, true},
+		{[]string{"127.0.0.53:53"}, true},
+		{[]string{"127.0.0.1:53", "8.8.8.8:53"}, false},
+		{[]string{"127.0.0.1:53", "localhost:53"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		conf := &DnsConfig{Servers: tt.servers}
+		if got := conf.IsLoopbackOnly(); got != tt.want {
+			t.Errorf("IsLoopbackOnly() with servers %q = %v; want %v", tt.servers, got, tt.want)
+		}
+	}
+}
+
+func TestIsSystemdResolvedStub(t *testing.T) {
+	tests := []struct {
+		servers []string
+		want    bool
+	}{
+		{[]string{"127.0.0.53:53"}, true},
+		{[]string{"127.0.0.53:53", "127.0.0.54:53"}, true},
+		{[]string{"127.0.0.1:53"}, false},
+		{[]string{"127.0.0.53:53", "8.8.8.8:53"}, false},
+		{[]string{"8.8.8.8:53"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		conf := &DnsConfig{Servers: tt.servers}
+		if got := conf.IsSystemdResolvedStub(); got != tt.want {
+			t.Errorf("IsSystemdResolvedStub() with servers %q = %v; want %v", tt.servers, got, tt.want)
+		}
+	}
+}
+
+func TestStubResolvers(t *testing.T) {
+	conf := &DnsConfig{Servers: []string{
+		"8.8.8.8:53",
+		"127.0.0.53:53",
+		"[2001:4860:4860::8888]:53",
+		"127.0.0.1:53",
+		"127.0.0.2:53",
+		"[::1]:53",
+		"10.0.0.1:53",
+	}}
+	want := []string{"127.0.0.53:53", "127.0.0.1:53", "[::1]:53"}
+	if got := conf.StubResolvers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("StubResolvers() = %q; want %q", got, want)
+	}
+	conf.Servers = []string{"8.8.8.8:53", "10.0.0.1:53"}
+	if got := conf.StubResolvers(); got != nil {
+		t.Errorf("StubResolvers() with no stubs = %q; want nil", got)
+	}
+}
+
+func TestADFlag(t *testing.T) {
+	for _, on := range []bool{false, true} {
+		if got := (&DnsConfig{TrustAD: on}).ADFlag(); got != on {
+			t.Errorf("ADFlag() with TrustAD %v = %v", on, got)
+		}
+	}
+}
+
+func TestAge(t *testing.T) {
+	conf := &DnsConfig{Mtime: time.Now().Add(-2 * time.Hour)}
+	if age := conf.Age(); age < 2*time.Hour || age > 3*time.Hour {
+		t.Errorf("Age() = %v; want about 2h", age)
+	}
+	if !conf.IsStale(time.Hour) {
+		t.Error("IsStale(1h) = false; want true")
+	}
+	if conf.IsStale(24 * time.Hour) {
+		t.Error("IsStale(24h) = true; want false")
+	}
+
+	conf = &DnsConfig{}
+	if age := conf.Age(); age != 0 {
+		t.Errorf("Age() with no Mtime = %v; want 0", age)
+	}
+	if conf.IsStale(0) {
+		t.Error("IsStale(0) with no Mtime = true; want false")
+	}
+}
+
+func TestNextServer(t *testing.T) {
+	origServerSeed := serverSeed
+	defer func() { serverSeed = origServerSeed }()
+	serverSeed = 4
+
+	servers := []string{"a:53", "b:53", "c:53"}
+	for _, rotate := range []bool{false, true} {
+		a := &DnsConfig{Servers: servers, Rotate: rotate}
+		b := &DnsConfig{Servers: servers, Rotate: rotate}
+		var got []string
+		for i := 0; i < 4; i++ {
+			s := a.NextServer()
+			if bs := b.NextServer(); bs != s {
+				t.Errorf("rotate %v: call %d: configs disagree: %q and %q", rotate, i, s, bs)
+			}
+			got = append(got, s)
+		}
+		want := []string{"a:53", "a:53", "a:53", "a:53"}
+		if rotate {
+			want = []string{"b:53", "c:53", "a:53", "b:53"}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("rotate %v: NextServer() = %q; want %q", rotate, got, want)
+		}
+	}
+}
+
+func TestServerURIs(t *testing.T) {
+	conf := &DnsConfig{Servers: []string{"8.8.8.8:53", "[2001:4860:4860::8888]:53"}}
+	want := []string{"udp://8.8.8.8:53", "udp://[2001:4860:4860::8888]:53"}
+	if got := conf.ServerURIs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ServerURIs() = %q; want %q", got, want)
+	}
+	conf.UseTCP = true
+	want = []string{"tcp://8.8.8.8:53", "tcp://[2001:4860:4860::8888]:53"}
+	if got := conf.ServerURIs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ServerURIs() with UseTCP = %q; want %q", got, want)
+	}
+}
+
+func TestIsAbsolute(t *testing.T) {
+	tests := []struct {
+		name  string
+		ndots int
+		want  bool
+	}{
+		{"host", 1, false},
+		{"host.", 1, true},
+		{"host.example", 1, true},
+		{"host.example", 2, false},
+		{"a.b.example", 2, true},
+		{"a.b.example", 3, false},
+		{"a.b.example.", 15, true},
+		{"host", 0, true},
+	}
+	for _, tt := range tests {
+		conf := &DnsConfig{Ndots: tt.ndots}
+		if got := conf.IsAbsolute(tt.name); got != tt.want {
+			t.Errorf("IsAbsolute(%q) with ndots %d = %v; want %v", tt.name, tt.ndots, got, tt.want)
+		}
+	}
+}
+
+func TestPerAttemptTimeout(t *testing.T) {
+	tests := []struct {
+		timeout  time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{5 * time.Second, 1, 5 * time.Second},
+		{5 * time.Second, 2, 2500 * time.Millisecond},
+		{6 * time.Second, 3, 2 * time.Second},
+		{5 * time.Second, 0, 5 * time.Second},
+		{time.Second, 3, 333333333 * time.Nanosecond},
+		{200 * time.Millisecond, 3, minAttemptTimeout},
+	}
+	for _, tt := range tests {
+		conf := &DnsConfig{Timeout: tt.timeout, Attempts: tt.attempts}
+		if got := conf.PerAttemptTimeout(); got != tt.want {
+			t.Errorf("PerAttemptTimeout() with timeout %v, attempts %d = %v; want %v", tt.timeout, tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestApplyEnvServers(t *testing.T) {
+	t.Setenv("DNS_SERVERS", "10.0.0.1, 8.8.8.8,bogus [2001:db8::1]:5353 10.0.0.1")
+	conf := &DnsConfig{
+		Servers:    []string{"8.8.8.8:53", "8.8.4.4:53"},
+		AllServers: []string{"8.8.8.8:53", "8.8.4.4:53", "1.1.1.1:53"},
+	}
+	conf.ApplyEnvServers("DNS_SERVERS")
+	want := []string{"10.0.0.1:53", "8.8.8.8:53", "[2001:db8::1]:5353", "8.8.4.4:53"}
+	if !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("Servers = %q; want %q", conf.Servers, want)
+	}
+	want = append(want, "1.1.1.1:53")
+	if !reflect.DeepEqual(conf.AllServers, want) {
+		t.Errorf("AllServers = %q; want %q", conf.AllServers, want)
+	}
+	if len(conf.Warnings) != 1 {
+		t.Errorf("Warnings = %q; want 1 warning", conf.Warnings)
+	}
+
+	// Servers that only stand in for a missing list are replaced.
+	t.Setenv("DNS_SERVERS", "10.0.0.1")
+	conf = DefaultConfig()
+	conf.ApplyEnvServers("DNS_SERVERS")
+	want = []string{"10.0.0.1:53"}
+	if !reflect.DeepEqual(conf.Servers, want) || !reflect.DeepEqual(conf.AllServers, want) || !conf.HasServers() {
+		t.Errorf("fallback servers: Servers = %q, AllServers = %q, HasServers() = %v; want %q, %q, true", conf.Servers, conf.AllServers, conf.HasServers(), want, want)
+	}
+
+	t.Setenv("DNS_SERVERS", "")
+	conf = &DnsConfig{Servers: []string{"8.8.8.8:53"}}
+	conf.ApplyEnvServers("DNS_SERVERS")
+	if want := []string{"8.8.8.8:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("empty variable: Servers = %q; want %q", conf.Servers, want)
+	}
+}
+
+func TestServersForTransport(t *testing.T) {
+	conf := &DnsConfig{
+		Servers:    []string{"8.8.8.8:53"},
+		DoTServers: []string{"1.1.1.1:853#cloudflare-dns.com"},
+	}
+	tests := []struct {
+		t    Transport
+		want []string
+	}{
+		{TransportUDP, conf.Servers},
+		{TransportTCP, conf.Servers},
+		{TransportDoT, conf.DoTServers},
+		{TransportDoH, nil},
+	}
+	for _, tt := range tests {
+		if got := conf.ServersForTransport(tt.t); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ServersForTransport(%d) = %q; want %q", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestReadDnsConfigContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conf := ReadDnsConfigContext(ctx)
+	if conf.Err != context.Canceled {
+		t.Errorf("got error %v; want %v", conf.Err, context.Canceled)
+	}
+	if !reflect.DeepEqual(conf.Servers, defaultNS) {
+		t.Errorf("got servers %q; want %q", conf.Servers, defaultNS)
+	}
+}
+
+func TestUsableServers(t *testing.T) {
+	conf := &DnsConfig{Servers: []string{
+		"0.0.0.0:53",
+		"8.8.8.8:53",
+		"[::]:53",
+		"224.0.0.251:53",
+		"[ff02::fb]:53",
+		"[::ffff:0.0.0.0]:53",
+		"[2001:4860:4860::8888]:53",
+	}}
+	want := []string{"8.8.8.8:53", "[2001:4860:4860::8888]:53"}
+	if got := conf.UsableServers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("UsableServers() = %q; want %q", got, want)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	conf := &DnsConfig{Rotate: true, UseTCP: true}
+	want := map[string]bool{"rotate": true, "use-vc": true}
+	if got := conf.Options(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Options() = %v; want %v", got, want)
+	}
+
+	var other DnsConfig
+	for name, on := range conf.Options() {
+		if err := other.SetOption(name, on); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !other.Rotate || !other.UseTCP || other.TrustAD {
+		t.Errorf("SetOption round trip: got %+v", other)
+	}
+	if err := other.SetOption("rotate", false); err != nil || other.Rotate {
+		t.Errorf("SetOption(rotate, false): got error %v, Rotate %v", err, other.Rotate)
+	}
+	if err := other.SetOption("ndots", true); err == nil {
+		t.Error("SetOption(ndots) succeeded; want error")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	conf := &DnsConfig{
+		Servers:      []string{"8.8.8.8:53", "[2001:4860:4860::8888]:53"},
+		Search:       []string{"example.com.", "corp.example.com."},
+		Ndots:        2,
+		Timeout:      3 * time.Second,
+		Attempts:     4,
+		Rotate:       true,
+		TrustAD:      true,
+		ExtraOptions: []string{"inet6"},
+		Warnings:     []string{"line 7: bad option"},
+	}
+	want := `servers: 2
+  8.8.8.8:53
+  [2001:4860:4860::8888]:53
+search: example.com. corp.example.com.
+ndots: 2, timeout: 3s, attempts: 4
+options: inet6 rotate trust-ad
+warning: line 7: bad option
+`
+	if got := conf.Summary(); got != want {
+		t.Errorf("Summary() =\n%s\nwant:\n%s", got, want)
+	}
+
+	conf = defaultConfig()
+	conf.Search = nil
+	conf.Err = errors.New("open /etc/resolv.conf: no such file or directory")
+	want = `servers: 2 (defaults, none configured)
+  127.0.0.1:53
+  [::1]:53
+search: none
+ndots: 1, timeout: 5s, attempts: 2
+error: open /etc/resolv.conf: no such file or directory
+`
+	if got := conf.Summary(); got != want {
+		t.Errorf("Summary() =\n%s\nwant:\n%s", got, want)
+	}
+}
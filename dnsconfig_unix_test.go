@@ -7,12 +7,18 @@
 package dnsconfig
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -23,16 +29,18 @@ var dnsReadConfigTests = []struct {
 	{
 		name: "testdata/resolv.conf",
 		want: &DnsConfig{
-			Servers:    []string{"8.8.8.8:53", "[2001:4860:4860::8888]:53", "[fe80::1%lo0]:53"},
-			Search:     []string{"localdomain."},
-			Ndots:      5,
-			Timeout:    10 * time.Second,
-			Attempts:   3,
-			Rotate:     true,
-			UnknownOpt: true, // the "options attempts 3" line
+			Servers:      []string{"8.8.8.8:53", "[2001:4860:4860::8888]:53", "[fe80::1%lo0]:53"},
+			Search:       []string{"localdomain."},
+			Ndots:        5,
+			Timeout:      10 * time.Second,
+			Attempts:     3,
+			Rotate:       true,
+			UnknownOpt:   true, // the "options attempts 3" line
+			ExtraOptions: []string{"attempts", "3"},
 		},
 	},
 	{
+		// search followed by domain: the later domain wins.
 		name: "testdata/domain-resolv.conf",
 		want: &DnsConfig{
 			Servers:  []string{"8.8.8.8:53"},
@@ -43,6 +51,7 @@ var dnsReadConfigTests = []struct {
 		},
 	},
 	{
+		// domain followed by search: the later search wins.
 		name: "testdata/search-resolv.conf",
 		want: &DnsConfig{
 			Servers:  []string{"8.8.8.8:53"},
@@ -127,12 +136,13 @@ var dnsReadConfigTests = []struct {
 	{
 		name: "testdata/single-request-reopen-resolv.conf",
 		want: &DnsConfig{
-			Servers:       defaultNS,
-			Ndots:         1,
-			SingleRequest: true,
-			Timeout:       5 * time.Second,
-			Attempts:      2,
-			Search:        []string{"domain.local."},
+			Servers:             defaultNS,
+			Ndots:               1,
+			SingleRequest:       true,
+			SingleRequestReopen: true,
+			Timeout:             5 * time.Second,
+			Attempts:            2,
+			Search:              []string{"domain.local."},
 		},
 	},
 	{
@@ -168,6 +178,260 @@ var dnsReadConfigTests = []struct {
 			Search:   []string{"domain.local."},
 		},
 	},
+	{
+		name: "testdata/freebsd-insecure-resolv.conf",
+		want: &DnsConfig{
+			Servers:   defaultNS,
+			Ndots:     1,
+			Timeout:   5 * time.Second,
+			Attempts:  2,
+			Search:    []string{"domain.local."},
+			Insecure1: true,
+			Insecure2: true,
+		},
+	},
+	{
+		name: "testdata/netbsd-resolv.conf",
+		want: &DnsConfig{
+			Servers:    []string{"192.168.0.1:53"},
+			Search:     []string{"example.org."},
+			Ndots:      2,
+			Timeout:    5 * time.Second,
+			Attempts:   2,
+			Rotate:     true,
+			NoTLDQuery: true,
+		},
+	},
+	{
+		name: "testdata/dragonfly-resolv.conf",
+		want: &DnsConfig{
+			Servers:    []string{"10.0.0.1:53"},
+			Ndots:      1,
+			Timeout:    5 * time.Second,
+			Attempts:   2,
+			Search:     []string{"domain.local."},
+			NoTLDQuery: true,
+			Insecure1:  true,
+		},
+	},
+	{
+		name: "testdata/no-trust-ad-resolv.conf",
+		want: &DnsConfig{
+			Servers:  defaultNS,
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			Search:   []string{"domain.local."},
+			TrustAD:  false,
+		},
+	},
+	{
+		name: "testdata/trust-ad-resolv.conf",
+		want: &DnsConfig{
+			Servers:  defaultNS,
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			Search:   []string{"domain.local."},
+			TrustAD:  true,
+		},
+	},
+	{
+		name: "testdata/extra-options-resolv.conf",
+		want: &DnsConfig{
+			Servers:           defaultNS,
+			Ndots:             1,
+			Timeout:           5 * time.Second,
+			Attempts:          2,
+			Search:            []string{"domain.local."},
+			UnknownOpt:        true,
+			ExtraOptions:      []string{"foo:bar", "v6-unreachable:", "inet6"},
+			ExtraOptionValues: map[string]string{"foo": "bar", "v6-unreachable": ""},
+		},
+	},
+	{
+		name: "testdata/no-reload-resolv.conf",
+		want: &DnsConfig{
+			Servers:  defaultNS,
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			Search:   []string{"domain.local."},
+			NoReload: true,
+		},
+	},
+	{
+		name: "testdata/dot-resolv.conf",
+		want: &DnsConfig{
+			Servers:    []string{"8.8.8.8:53"},
+			DoTServers: []string{"1.1.1.1:853#cloudflare-dns.com", "[2606:4700:4700::1111]:853#cloudflare-dns.com"},
+			Ndots:      1,
+			Timeout:    5 * time.Second,
+			Attempts:   2,
+			Search:     []string{"domain.local."},
+			Warnings: []string{
+				`invalid DNS-over-TLS nameserver "9.9.9.9#"`,
+				`invalid DNS-over-TLS nameserver "1.1.1.1#"`,
+				`invalid DNS-over-TLS nameserver "dns.quad9.net#dns.quad9.net"`,
+			},
+		},
+	},
+	{
+		name: "testdata/max-search-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53"},
+			Search:   []string{"a.", "b.", "c.", "d.", "e.", "f."},
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			Warnings: []string{
+				"too many search domains, ignoring g.",
+				"too many search domains, ignoring h.",
+			},
+		},
+	},
+	{
+		name: "testdata/long-search-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53"},
+			Search:   []string{"example.com.", "example.net."},
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			Warnings: []string{"search domain too long, ignoring " + strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 63) + ".example."},
+		},
+	},
+	{
+		name: "testdata/bom-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53"},
+			Search:   []string{"localdomain."},
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+		},
+	},
+	{
+		name: "testdata/trailing-comment-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53", "8.8.4.4:53"},
+			Search:   []string{"example.com."},
+			Ndots:    2,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			Rotate:   true,
+		},
+	},
+	{
+		name: "testdata/crlf-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53", "8.8.4.4:53"},
+			Search:   []string{"localdomain."},
+			Ndots:    2,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			Rotate:   true,
+		},
+	},
+	{
+		name: "testdata/whitespace-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53", "8.8.4.4:53"},
+			Search:   []string{"example.com.", "example.net."},
+			Ndots:    3,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			UseTCP:   true,
+		},
+	},
+	{
+		// Name servers accumulate in file order, up to the limit,
+		// while the last search or domain line wins and options
+		// lines combine.
+		name: "testdata/interleaved-resolv.conf",
+		want: &DnsConfig{
+			Servers:    []string{"10.0.0.1:53", "10.0.0.2:53", "10.0.0.3:53"},
+			AllServers: []string{"10.0.0.1:53", "10.0.0.2:53", "10.0.0.3:53", "10.0.0.4:53"},
+			Search:     []string{"c.example."},
+			Ndots:      3,
+			Timeout:    3 * time.Second,
+			Attempts:   2,
+			Rotate:     true,
+		},
+	},
+	{
+		name: "testdata/ndots-space-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53"},
+			Ndots:    5,
+			Timeout:  3 * time.Second,
+			Attempts: 4,
+			Rotate:   true,
+		},
+	},
+	{
+		name: "testdata/multi-search-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53"},
+			Search:   []string{"d.example.", "e.example.", "f.example.", "g.example."},
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+		},
+	},
+	{
+		name: "testdata/unspecified-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"127.0.0.1:53", "[::1]:53", "8.8.8.8:53"},
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+		},
+	},
+	{
+		name: "testdata/quoted-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53"},
+			Search:   []string{"example.com.", "corp.example.com."},
+			Ndots:    2,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+			Rotate:   true,
+		},
+	},
+	{
+		// A repeated server does not count against the limit of
+		// three, but is kept in AllServers.
+		name: "testdata/duplicate-servers-resolv.conf",
+		want: &DnsConfig{
+			Servers:    []string{"8.8.8.8:53", "1.1.1.1:53", "9.9.9.9:53"},
+			AllServers: []string{"8.8.8.8:53", "8.8.8.8:53", "1.1.1.1:53", "9.9.9.9:53"},
+			Ndots:      1,
+			Timeout:    5 * time.Second,
+			Attempts:   2,
+		},
+	},
+	{
+		// A quoted empty token is dropped rather than kept as an
+		// empty field.
+		name: "testdata/empty-quoted-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53"},
+			Search:   []string{},
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 2,
+		},
+	},
+	{
+		name: "testdata/retries-resolv.conf",
+		want: &DnsConfig{
+			Servers:  []string{"8.8.8.8:53"},
+			Ndots:    1,
+			Timeout:  5 * time.Second,
+			Attempts: 4,
+		},
+	},
 }
 
 func TestDNSReadConfig(t *testing.T) {
@@ -177,9 +441,14 @@ func TestDNSReadConfig(t *testing.T) {
 
 	for _, tt := range dnsReadConfigTests {
 		want := *tt.want
-		if len(want.Search) == 0 {
+		if want.Search == nil {
 			want.Search = dnsDefaultSearch()
 		}
+		if want.AllServers == nil {
+			want.AllServers = want.Servers
+		}
+		want.fallbackServers = reflect.DeepEqual(want.Servers, defaultNS)
+		want.ResolvedPath = tt.name
 		conf := dnsReadConfig(tt.name)
 		if conf.Err != nil {
 			t.Fatal(conf.Err)
@@ -202,21 +471,36 @@ func TestDNSReadMissingFile(t *testing.T) {
 	}
 	conf.Err = nil
 	want := &DnsConfig{
-		Servers:  defaultNS,
-		Ndots:    1,
-		Timeout:  5 * time.Second,
-		Attempts: 2,
-		Search:   []string{"domain.local."},
+		Servers:         defaultNS,
+		AllServers:      defaultNS,
+		Ndots:           1,
+		Timeout:         5 * time.Second,
+		Attempts:        2,
+		Search:          []string{"domain.local."},
+		fallbackServers: true,
 	}
 	if !reflect.DeepEqual(conf, want) {
 		t.Errorf("missing resolv.conf:\ngot: %+v\nwant: %+v", conf, want)
 	}
 }
 
+func TestDefaultConfig(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	conf := dnsReadConfig("a-nonexistent-file")
+	conf.Err = nil
+	if want := DefaultConfig(); !reflect.DeepEqual(conf, want) {
+		t.Errorf("got: %+v\nwant: %+v", conf, want)
+	}
+}
+
 var dnsDefaultSearchTests = []struct {
-	name string
-	err  error
-	want []string
+	name         string
+	err          error
+	walksParents bool
+	want         []string
 }{
 	{
 		name: "host.long.domain.local",
@@ -241,17 +525,41 @@ var dnsDefaultSearchTests = []struct {
 		name: "foo.",
 		want: nil,
 	},
+	{
+		name:         "host.a.b.example.com",
+		walksParents: true,
+		want:         []string{"a.b.example.com.", "b.example.com.", "example.com."},
+	},
+	{
+		name:         "host.a.b.example.com.",
+		walksParents: true,
+		want:         []string{"a.b.example.com.", "b.example.com.", "example.com."},
+	},
+	{
+		name:         "host.local.",
+		walksParents: true,
+		want:         []string{"local."},
+	},
+	{
+		name: "host.a.b.example.com",
+		want: []string{"a.b.example.com."},
+	},
 }
 
 func TestDNSDefaultSearch(t *testing.T) {
 	origGetHostname := getHostname
-	defer func() { getHostname = origGetHostname }()
+	origWalksParents := DefaultSearchWalksParents
+	defer func() {
+		getHostname = origGetHostname
+		DefaultSearchWalksParents = origWalksParents
+	}()
 
 	for _, tt := range dnsDefaultSearchTests {
 		getHostname = func() (string, error) { return tt.name, tt.err }
+		DefaultSearchWalksParents = tt.walksParents
 		got := dnsDefaultSearch()
 		if !reflect.DeepEqual(got, tt.want) {
-			t.Errorf("dnsDefaultSearch with hostname %q and error %+v = %q, wanted %q", tt.name, tt.err, got, tt.want)
+			t.Errorf("dnsDefaultSearch with hostname %q, error %+v and walksParents %v = %q, wanted %q", tt.name, tt.err, tt.walksParents, got, tt.want)
 		}
 	}
 }
@@ -312,3 +620,1036 @@ func TestDNSNameLength(t *testing.T) {
 		}
 	}
 }
+
+func TestDNSReadConfigNdotsEnv(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	tests := []struct {
+		env      string
+		ndots    int
+		warnings int
+	}{
+		{env: "3", ndots: 3},
+		{env: "0", ndots: 0},
+		{env: "16", ndots: 15},
+		{env: "many", ndots: 5, warnings: 1},
+		{env: "", ndots: 5}, // as if unset
+	}
+	for _, tt := range tests {
+		t.Setenv(NdotsEnv, tt.env)
+		conf := ReadDnsConfig(WithFile("testdata/resolv.conf"))
+		if conf.Err != nil {
+			t.Fatal(conf.Err)
+		}
+		if conf.Ndots != tt.ndots || len(conf.Warnings) != tt.warnings {
+			t.Errorf("%s=%q: got ndots %d, warnings %q; want ndots %d, %d warnings", NdotsEnv, tt.env, conf.Ndots, conf.Warnings, tt.ndots, tt.warnings)
+		}
+
+		// Only the system config is overridden, not one parsed
+		// from another source.
+		conf = dnsReadConfig("testdata/resolv.conf")
+		if conf.Ndots != 5 || len(conf.Warnings) != 0 {
+			t.Errorf("%s=%q: parsed config has ndots %d, warnings %q; want ndots 5, no warnings", NdotsEnv, tt.env, conf.Ndots, conf.Warnings)
+		}
+	}
+}
+
+func TestNewDefaultConfig(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host", nil }
+
+	conf := dnsReadConfig("testdata/empty-resolv.conf")
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	conf.Mtime = time.Time{}
+	conf.ResolvedPath = ""
+	if want := NewDefaultConfig(); !reflect.DeepEqual(conf, want) {
+		t.Errorf("got: %+v\nwant: %+v", conf, want)
+	}
+}
+
+func TestSearchSuffixes(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	for _, tt := range dnsReadConfigTests {
+		conf := dnsReadConfig(tt.name)
+		if conf.Err != nil {
+			t.Fatal(conf.Err)
+		}
+		conf.Ndots = 1
+		var want []string
+		for _, name := range conf.nameList("host") {
+			suffix := strings.TrimPrefix(name, "host.")
+			if suffix == "" {
+				suffix = "."
+			}
+			want = append(want, suffix)
+		}
+		if got := conf.SearchSuffixes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: SearchSuffixes() = %q; want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestDNSReadResolvedUpstream(t *testing.T) {
+	tests := []struct {
+		stub, upstream string
+		want           []string
+	}{
+		{
+			stub:     "testdata/resolved-stub-resolv.conf",
+			upstream: "testdata/resolved-upstream-resolv.conf",
+			want:     []string{"192.168.1.1:53", "[2001:db8::1]:53"},
+		},
+		{
+			stub:     "testdata/resolved-stub-resolv.conf",
+			upstream: "a-nonexistent-file",
+			want:     []string{"127.0.0.53:53"},
+		},
+		{
+			stub:     "testdata/domain-resolv.conf",
+			upstream: "testdata/resolved-upstream-resolv.conf",
+			want:     []string{"8.8.8.8:53"},
+		},
+	}
+	for _, tt := range tests {
+		conf := dnsReadResolvedUpstream(tt.stub, tt.upstream)
+		if conf.Err != nil {
+			t.Fatal(conf.Err)
+		}
+		if !reflect.DeepEqual(conf.Servers, tt.want) {
+			t.Errorf("dnsReadResolvedUpstream(%q, %q).Servers = %q; want %q", tt.stub, tt.upstream, conf.Servers, tt.want)
+		}
+	}
+}
+
+func TestDNSReadConfigTooLarge(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	name := t.TempDir() + "/resolv.conf"
+	data := strings.Repeat("nameserver 8.8.8.8\n", int(MaxConfigBytes)/19+1)
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := dnsReadConfig(name)
+	if !errors.Is(conf.Err, ErrConfigTooLarge) {
+		t.Errorf("got error %v; want %v", conf.Err, ErrConfigTooLarge)
+	}
+	if !reflect.DeepEqual(conf.Servers, defaultNS) || !reflect.DeepEqual(conf.Search, []string{"domain.local."}) {
+		t.Errorf("got servers %q, search %q; want defaults", conf.Servers, conf.Search)
+	}
+}
+
+func TestReadDnsConfigOptions(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+	t.Setenv(NdotsEnv, "2")
+
+	conf := ReadDnsConfig(WithFile("testdata/resolv.conf"))
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	if len(conf.Servers) != 3 || conf.Ndots != 2 {
+		t.Errorf("default options: got servers %q, ndots %d; want 3 servers, ndots 2", conf.Servers, conf.Ndots)
+	}
+
+	conf = ReadDnsConfig(WithFile("testdata/resolv.conf"), WithEnvOverrides(false))
+	if conf.Ndots != 5 {
+		t.Errorf("WithEnvOverrides(false): got ndots %d; want 5", conf.Ndots)
+	}
+
+	conf = ReadDnsConfig(WithFile("testdata/resolv.conf"), WithMaxServers(1))
+	if want := []string{"8.8.8.8:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("WithMaxServers(1): got servers %q; want %q", conf.Servers, want)
+	}
+
+	conf = ReadDnsConfig(WithFile("a-nonexistent-file"))
+	if !os.IsNotExist(conf.Err) {
+		t.Errorf("WithFile(missing): got error %v; want %v", conf.Err, fs.ErrNotExist)
+	}
+}
+
+func TestDNSReadConfigExplicitEmptySearch(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	conf := dnsReadConfig("testdata/search-single-dot-resolv.conf")
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	if conf.Search == nil || len(conf.Search) != 0 {
+		t.Errorf(`"search .": got search %q; want empty`, conf.Search)
+	}
+
+	conf = dnsReadConfig("testdata/empty-resolv.conf")
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	if want := []string{"domain.local."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("no search line: got search %q; want %q", conf.Search, want)
+	}
+}
+
+func TestDefaultResolvFile(t *testing.T) {
+	if DefaultResolvFile == "" {
+		t.Error("DefaultResolvFile is empty")
+	}
+}
+
+func TestReadDnsConfigWithStats(t *testing.T) {
+	unsetNdotsEnv(t)
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	conf, stats := ReadDnsConfigWithStats(WithFile("testdata/resolv.conf"), WithMaxServers(2))
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	want := &Stats{
+		FileExisted:    true,
+		ServersFound:   2,
+		ServersSkipped: 1,
+		SearchCount:    1,
+		UnknownOptions: 2, // the "options attempts 3" line
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got stats %+v; want %+v", stats, want)
+	}
+
+	_, stats = ReadDnsConfigWithStats(WithFile("a-nonexistent-file"))
+	want = &Stats{SearchCount: 1}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("missing file: got stats %+v; want %+v", stats, want)
+	}
+}
+
+func TestDNSConfigWriteTo(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	for _, tt := range dnsReadConfigTests {
+		conf := dnsReadConfig(tt.name)
+		if conf.Err != nil {
+			t.Fatal(conf.Err)
+		}
+		name := t.TempDir() + "/resolv.conf"
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conf.WriteTo(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		got := dnsReadConfig(name)
+		if got.Err != nil {
+			t.Fatal(got.Err)
+		}
+		if diff := conf.Diff(got); diff != nil {
+			t.Errorf("%s: round trip changed config: %q", tt.name, diff)
+		}
+	}
+}
+
+func TestWriteToDeterministic(t *testing.T) {
+	a := ParseDnsConfigBytes([]byte("nameserver 8.8.8.8\nsearch b.example a.example\noptions v6-unreachable: rotate foo:1 ndots:3 inet6 foo:2 trust-ad\n"))
+	b := &DnsConfig{
+		Servers:      []string{"8.8.8.8:53"},
+		Search:       []string{"b.example.", "a.example."},
+		Ndots:        3,
+		Timeout:      5 * time.Second,
+		Attempts:     2,
+		TrustAD:      true,
+		Rotate:       true,
+		UnknownOpt:   true,
+		ExtraOptions: []string{"foo:1", "inet6", "foo:2", "v6-unreachable:"},
+	}
+	var wa, wb strings.Builder
+	if _, err := a.WriteTo(&wa); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.WriteTo(&wb); err != nil {
+		t.Fatal(err)
+	}
+	const want = "nameserver 8.8.8.8\n" +
+		"search b.example. a.example.\n" +
+		"options foo:1 foo:2 inet6 ndots:3 rotate trust-ad v6-unreachable:\n"
+	if wa.String() != want || wb.String() != want {
+		t.Errorf("got:\n%s\nand:\n%s\nwant:\n%s", wa.String(), wb.String(), want)
+	}
+	if diff := a.Diff(b); diff != nil {
+		t.Errorf("Diff = %q; want none", diff)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	conf := &DnsConfig{
+		Servers:  []string{"8.8.8.8:53"},
+		Search:   []string{"example.com."},
+		Ndots:    1,
+		Timeout:  5 * time.Second,
+		Attempts: 2,
+	}
+	dir := t.TempDir()
+	name := dir + "/resolv.conf"
+	if err := conf.WriteFileAtomic(name, 0640); err != nil {
+		t.Fatal(err)
+	}
+	const want = "nameserver 8.8.8.8\nsearch example.com.\n"
+	if b, err := os.ReadFile(name); err != nil || string(b) != want {
+		t.Errorf("got contents %q, %v; want %q", b, err, want)
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("got mode %v, %v; want %v", fi.Mode().Perm(), err, os.FileMode(0640))
+	}
+
+	defer func(f func(*os.File) error) { syncFile = f }(syncFile)
+	syncFile = func(*os.File) error { return errors.New("sync failed") }
+	conf.Servers = []string{"1.1.1.1:53"}
+	if err := conf.WriteFileAtomic(name, 0644); err == nil {
+		t.Error("WriteFileAtomic succeeded; want error")
+	}
+	if b, err := os.ReadFile(name); err != nil || string(b) != want {
+		t.Errorf("after failed write: got contents %q, %v; want %q", b, err, want)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("after failed write: got directory entries %v, %v; want only resolv.conf", entries, err)
+	}
+}
+
+func TestReadServers(t *testing.T) {
+	for _, tt := range dnsReadConfigTests {
+		servers, err := ReadServers(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := dnsReadConfig(tt.name).Servers
+		if servers == nil {
+			servers = defaultNS
+		}
+		if !reflect.DeepEqual(servers, want) {
+			t.Errorf("ReadServers(%q) = %q; want %q", tt.name, servers, want)
+		}
+	}
+
+	// The settings that change how nameserver lines are read apply
+	// to ReadServers too.
+	defer func(split, dnsmasq, priority, includes bool) {
+		SplitCommaSeparatedServers, DnsmasqCompat, ParseServerPriorityComments, AllowIncludes = split, dnsmasq, priority, includes
+	}(SplitCommaSeparatedServers, DnsmasqCompat, ParseServerPriorityComments, AllowIncludes)
+	SplitCommaSeparatedServers, DnsmasqCompat, ParseServerPriorityComments, AllowIncludes = true, true, true, true
+	for _, name := range []string{
+		"testdata/comma-servers-resolv.conf",
+		"testdata/dnsmasq.conf",
+		"testdata/priority-resolv.conf",
+		"testdata/include-resolv.conf",
+	} {
+		servers, err := ReadServers(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := dnsReadConfig(name).Servers; !reflect.DeepEqual(servers, want) {
+			t.Errorf("ReadServers(%q) with all settings on = %q; want %q", name, servers, want)
+		}
+	}
+
+	if _, err := ReadServers("a-nonexistent-file"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadServers of missing file: got error %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestReadDnsConfigStrict(t *testing.T) {
+	conf, err := ReadDnsConfigStrict("testdata/search-resolv.conf")
+	if err != nil {
+		t.Errorf("clean file: got error %v", err)
+	}
+	if conf == nil || len(conf.Servers) != 1 {
+		t.Errorf("clean file: got config %+v", conf)
+	}
+
+	name := t.TempDir() + "/resolv.conf"
+	if err := os.WriteFile(name, []byte("nameserver 8.8.8.8\nnameserver 8.8.8.300\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err = ReadDnsConfigStrict(name)
+	if err == nil {
+		t.Error("bad nameserver: got nil error")
+	}
+	if want := []string{"8.8.8.8:53"}; conf == nil || !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("bad nameserver: got config %+v; want servers %q", conf, want)
+	}
+
+	if _, err := ReadDnsConfigStrict("testdata/resolv.conf"); err == nil {
+		t.Error("unknown option: got nil error")
+	}
+}
+
+func TestReadDnsConfigWithFallbacks(t *testing.T) {
+	conf := ReadDnsConfigWithFallbacks("a-nonexistent-file", "testdata/search-resolv.conf")
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	if want := []string{"8.8.8.8:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if len(conf.Warnings) != 1 || !strings.Contains(conf.Warnings[0], "a-nonexistent-file") {
+		t.Errorf("got warnings %q; want one about a-nonexistent-file", conf.Warnings)
+	}
+
+	conf = ReadDnsConfigWithFallbacks("a-nonexistent-file", "another-nonexistent-file")
+	if !errors.Is(conf.Err, fs.ErrNotExist) || len(conf.Warnings) != 1 {
+		t.Errorf("all missing: got error %v, warnings %q; want %v and one warning", conf.Err, conf.Warnings, fs.ErrNotExist)
+	}
+}
+
+func TestDNSReadConfigSymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Symlink(dir+"/b.conf", dir+"/a.conf"); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink("a.conf", dir+"/b.conf"); err != nil {
+		t.Fatal(err)
+	}
+	conf := dnsReadConfig(dir + "/a.conf")
+	if !errors.Is(conf.Err, syscall.ELOOP) {
+		t.Errorf("got error %v; want %v", conf.Err, syscall.ELOOP)
+	}
+	if !reflect.DeepEqual(conf.Servers, defaultNS) {
+		t.Errorf("got servers %q; want %q", conf.Servers, defaultNS)
+	}
+
+	target, err := filepath.Abs("testdata/search-resolv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, dir+"/c.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("c.conf", dir+"/d.conf"); err != nil {
+		t.Fatal(err)
+	}
+	conf = dnsReadConfig(dir + "/d.conf")
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	if want := []string{"8.8.8.8:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("symlink chain: got servers %q; want %q", conf.Servers, want)
+	}
+}
+
+func TestDNSReadConfigPermissionDenied(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("skipping test when running as root")
+	}
+	name := t.TempDir() + "/resolv.conf"
+	if err := os.WriteFile(name, []byte("nameserver 8.8.8.8\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	conf := dnsReadConfig(name)
+	if !errors.Is(conf.Err, fs.ErrPermission) || errors.Is(conf.Err, fs.ErrNotExist) {
+		t.Errorf("got error %v; want %v", conf.Err, fs.ErrPermission)
+	}
+	var pe *fs.PathError
+	if !errors.As(conf.Err, &pe) || pe.Path != name {
+		t.Errorf("got error %#v; want *fs.PathError for %s", conf.Err, name)
+	}
+	if !reflect.DeepEqual(conf.Servers, defaultNS) {
+		t.Errorf("got servers %q; want %q", conf.Servers, defaultNS)
+	}
+}
+
+func TestDNSReadConfigCommaSeparatedServers(t *testing.T) {
+	defer func(orig bool) { SplitCommaSeparatedServers = orig }(SplitCommaSeparatedServers)
+
+	tests := []struct {
+		split bool
+		want  []string
+	}{
+		{false, defaultNS},
+		{true, []string{"8.8.8.8:53", "8.8.4.4:53", "1.1.1.1:53"}},
+	}
+	for _, tt := range tests {
+		SplitCommaSeparatedServers = tt.split
+		conf := dnsReadConfig("testdata/comma-servers-resolv.conf")
+		if conf.Err != nil {
+			t.Fatal(conf.Err)
+		}
+		if !reflect.DeepEqual(conf.Servers, tt.want) {
+			t.Errorf("SplitCommaSeparatedServers=%v: got servers %q; want %q", tt.split, conf.Servers, tt.want)
+		}
+	}
+}
+
+func TestShouldReload(t *testing.T) {
+	unsetNdotsEnv(t)
+	if conf := dnsReadConfig("testdata/no-reload-resolv.conf"); conf.ShouldReload() {
+		t.Error("ShouldReload() = true with no-reload option")
+	}
+	if conf := dnsReadConfig("testdata/resolv.conf"); !conf.ShouldReload() {
+		t.Error("ShouldReload() = false without no-reload option")
+	}
+}
+
+func TestParseDnsConfigBytes(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	for _, tt := range dnsReadConfigTests {
+		b, err := os.ReadFile(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ParseDnsConfigBytes(b)
+		if want := ParseDnsConfig(bytes.NewReader(b)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: ParseDnsConfigBytes:\ngot: %+v\nwant: %+v", tt.name, got, want)
+		}
+		want := dnsReadConfig(tt.name)
+		want.Mtime = time.Time{}
+		want.ResolvedPath = ""
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: ParseDnsConfigBytes differs from reading the file:\ngot: %+v\nwant: %+v", tt.name, got, want)
+		}
+	}
+
+	// Lines on either side of the read buffer size, with and without
+	// a final newline. The size limit is raised so that only the line
+	// length is in play.
+	defer func(n int64) { MaxConfigBytes = n }(MaxConfigBytes)
+	MaxConfigBytes = 1 << 20
+	for _, n := range []int{bufSize - 1, bufSize, 70000} {
+		for _, end := range []string{"\n", ""} {
+			b := []byte("nameserver 1.1.1.1\nsearch " + strings.Repeat("x", n-len("search ")) + end)
+			got := ParseDnsConfigBytes(b)
+			if want := ParseDnsConfig(bytes.NewReader(b)); !reflect.DeepEqual(got, want) {
+				t.Errorf("%d-byte line: ParseDnsConfigBytes:\ngot: %+v\nwant: %+v", n, got, want)
+			}
+			if tooLong := errors.Is(got.Err, bufio.ErrTooLong); tooLong != (n >= bufSize) {
+				t.Errorf("%d-byte line: got error %v", n, got.Err)
+			}
+		}
+	}
+}
+
+func TestLibcFlavorNegativeNdots(t *testing.T) {
+	defer func(l Libc) { LibcFlavor = l }(LibcFlavor)
+
+	tests := []struct {
+		libc Libc
+		want int
+	}{
+		{Glibc, 0},
+		{Musl, 1}, // ignored, leaving the default
+		{BSD, 15}, // -1 in a 4-bit field
+	}
+	for _, tt := range tests {
+		LibcFlavor = tt.libc
+		conf := dnsReadConfig("testdata/negative-ndots-resolv.conf")
+		if conf.Ndots != tt.want {
+			t.Errorf("LibcFlavor %d: got ndots %d; want %d", tt.libc, conf.Ndots, tt.want)
+		}
+	}
+}
+
+func TestAllServers(t *testing.T) {
+	unsetNdotsEnv(t)
+	conf := ReadDnsConfig(WithFile("testdata/many-servers-resolv.conf"), WithMaxServers(3))
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	want := []string{"10.0.0.1:53", "10.0.0.2:53", "10.0.0.3:53", "10.0.0.4:53", "10.0.0.5:53"}
+	if !reflect.DeepEqual(conf.AllServers, want) {
+		t.Errorf("AllServers = %q; want %q", conf.AllServers, want)
+	}
+	if !reflect.DeepEqual(conf.Servers, want[:3]) {
+		t.Errorf("Servers = %q; want %q", conf.Servers, want[:3])
+	}
+}
+
+func TestCanonicalServers(t *testing.T) {
+	conf := ParseDnsConfigBytes([]byte("nameserver 2001:DB8:0:0::1\nnameserver FE80::1%eth0\nnameserver 0:0:0:0:0:FFFF:0A00:0001\nnameserver 08.8.8.8\n"))
+	want := []string{"[2001:db8::1]:53", "[fe80::1%eth0]:53", "[::ffff:10.0.0.1]:53"}
+	if !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if len(conf.Warnings) != 1 {
+		t.Errorf("got warnings %q; want one for the non-canonical IPv4 address", conf.Warnings)
+	}
+}
+
+func TestLookupOrder(t *testing.T) {
+	conf := dnsReadConfig("testdata/openbsd-lookup-resolv.conf")
+	got, err := conf.LookupOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []LookupSource{LookupFile, LookupBind, LookupYP}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupOrder() = %v; want %v", got, want)
+	}
+
+	conf = dnsReadConfig("testdata/openbsd-bad-lookup-resolv.conf")
+	if got, err := conf.LookupOrder(); err == nil {
+		t.Errorf("LookupOrder() = %v; want error for unknown database", got)
+	}
+}
+
+func TestNameListDetailed(t *testing.T) {
+	conf := &DnsConfig{Ndots: 1, Search: []string{"example.com.", "example.net."}}
+	tests := []struct {
+		name string
+		want []NameCandidate
+	}{
+		// Too few dots: search domains first, then the name itself.
+		{"host", []NameCandidate{
+			{"host.example.com.", true},
+			{"host.example.net.", true},
+			{"host.", false},
+		}},
+		// Enough dots: the name itself first.
+		{"www.example", []NameCandidate{
+			{"www.example.", false},
+			{"www.example.example.com.", true},
+			{"www.example.example.net.", true},
+		}},
+		// Rooted: only the name itself.
+		{"host.", []NameCandidate{{"host.", false}}},
+	}
+	for _, tt := range tests {
+		got := conf.NameListDetailed(tt.name)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NameListDetailed(%q) = %v; want %v", tt.name, got, tt.want)
+		}
+		names := conf.nameList(tt.name)
+		for i := range got {
+			if i >= len(names) || got[i].FQDN != names[i] {
+				t.Errorf("NameListDetailed(%q) = %v; does not match nameList %q", tt.name, got, names)
+				break
+			}
+		}
+	}
+}
+
+func TestParseServerPriorityComments(t *testing.T) {
+	defer func(v bool) { ParseServerPriorityComments = v }(ParseServerPriorityComments)
+
+	conf := dnsReadConfig("testdata/priority-resolv.conf")
+	if want := []string{"10.0.0.1:53", "10.0.0.2:53", "10.0.0.3:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("ParseServerPriorityComments off: got servers %q; want %q", conf.Servers, want)
+	}
+
+	ParseServerPriorityComments = true
+	conf = dnsReadConfig("testdata/priority-resolv.conf")
+	if want := []string{"10.0.0.3:53", "10.0.0.2:53", "10.0.0.4:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if want := []string{"10.0.0.3:53", "10.0.0.2:53", "10.0.0.4:53", "10.0.0.1:53"}; !reflect.DeepEqual(conf.AllServers, want) {
+		t.Errorf("got all servers %q; want %q", conf.AllServers, want)
+	}
+}
+
+func TestPunycodeSearchDomains(t *testing.T) {
+	defer func(v bool) { PunycodeSearchDomains = v }(PunycodeSearchDomains)
+
+	const data = "nameserver 8.8.8.8\nsearch münchen.example Example.COM bad\u00ad\u200d.example\n"
+	conf := ParseDnsConfigBytes([]byte(data))
+	if want := []string{"münchen.example.", "Example.COM.", "bad\u00ad\u200d.example."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("PunycodeSearchDomains off: got search %q; want %q", conf.Search, want)
+	}
+
+	PunycodeSearchDomains = true
+	conf = ParseDnsConfigBytes([]byte(data))
+	if want := []string{"xn--mnchen-3ya.example.", "Example.COM."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("got search %q; want %q", conf.Search, want)
+	}
+	if len(conf.Warnings) != 1 {
+		t.Errorf("got warnings %q; want one for the invalid domain", conf.Warnings)
+	}
+
+	conf = ParseDnsConfigBytes([]byte("domain bücher.example\n"))
+	if want := []string{"xn--bcher-kva.example."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("domain: got search %q; want %q", conf.Search, want)
+	}
+}
+
+func TestDotServer(t *testing.T) {
+	tests := []struct {
+		s, want string
+		ok      bool
+	}{
+		{"1.1.1.1#cloudflare-dns.com", "1.1.1.1:853#cloudflare-dns.com", true},
+		{"1.1.1.1#", "", false},
+		// The parser takes a field starting with '#' for a comment,
+		// so an empty address reaches dotServer only directly.
+		{"#cloudflare-dns.com", "", false},
+		{"#", "", false},
+		{"dns.quad9.net#dns.quad9.net", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := dotServer(tt.s); got != tt.want || ok != tt.ok {
+			t.Errorf("dotServer(%q) = %q, %v; want %q, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReadNSSwitch(t *testing.T) {
+	unsetNdotsEnv(t)
+	got, err := ReadNSSwitch("testdata/nsswitch.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"files", "mdns4_minimal", "dns", "myhostname"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadNSSwitch = %q; want %q", got, want)
+	}
+
+	// A line too long to read stops the file short of its hosts line.
+	path := filepath.Join(t.TempDir(), "nsswitch.conf")
+	data := "passwd: files\n#" + strings.Repeat("x", bufSize) + "\nhosts: dns\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadNSSwitch(path); !errors.Is(err, bufio.ErrTooLong) || got != nil {
+		t.Errorf("ReadNSSwitch with an over-long line = %q, %v; want nil, %v", got, err, bufio.ErrTooLong)
+	}
+
+	conf := ReadDnsConfig(WithFile("testdata/resolv.conf"), WithNSSwitch("testdata/nsswitch.conf"))
+	if !reflect.DeepEqual(conf.NSSwitch, want) || conf.Lookup != nil {
+		t.Errorf("WithNSSwitch: got nsswitch %q, lookup %q; want %q, none", conf.NSSwitch, conf.Lookup, want)
+	}
+	order, err := conf.LookupOrder()
+	if wantOrder := []LookupSource{LookupFile, LookupBind}; err != nil || !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("WithNSSwitch: LookupOrder() = %v, %v; want %v", order, err, wantOrder)
+	}
+	var b strings.Builder
+	if _, err := conf.WriteTo(&b); err != nil || strings.Contains(b.String(), "lookup") {
+		t.Errorf("WithNSSwitch: WriteTo wrote %q, %v; want no lookup line", b.String(), err)
+	}
+
+	// An OpenBSD lookup directive takes precedence.
+	conf = &DnsConfig{Lookup: []string{"bind"}, NSSwitch: []string{"files", "dns"}}
+	order, err = conf.LookupOrder()
+	if wantOrder := []LookupSource{LookupBind}; err != nil || !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("WithNSSwitch and lookup directive: LookupOrder() = %v, %v; want %v", order, err, wantOrder)
+	}
+
+	conf = ReadDnsConfig(WithFile("testdata/resolv.conf"), WithNSSwitch("a-nonexistent-file"))
+	if len(conf.NSSwitch) != 0 || len(conf.Warnings) != 0 {
+		t.Errorf("missing nsswitch.conf: got nsswitch %q, warnings %q; want neither", conf.NSSwitch, conf.Warnings)
+	}
+}
+
+func TestAllowHostnameServers(t *testing.T) {
+	defer func(v bool) { AllowHostnameServers = v }(AllowHostnameServers)
+
+	conf := dnsReadConfig("testdata/hostname-server-resolv.conf")
+	if conf.UnresolvedServers != nil || len(conf.Warnings) != 2 {
+		t.Errorf("AllowHostnameServers off: got unresolved servers %q, warnings %q; want none, 2 warnings", conf.UnresolvedServers, conf.Warnings)
+	}
+
+	AllowHostnameServers = true
+	conf = dnsReadConfig("testdata/hostname-server-resolv.conf")
+	if want := []string{"10.0.0.1:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if want := []string{"dns.internal"}; !reflect.DeepEqual(conf.UnresolvedServers, want) {
+		t.Errorf("got unresolved servers %q; want %q", conf.UnresolvedServers, want)
+	}
+	if len(conf.Warnings) != 1 {
+		t.Errorf("got warnings %q; want one for the invalid name", conf.Warnings)
+	}
+}
+
+// largeConfig returns a resolv.conf with many lines of each directive.
+func largeConfig() []byte {
+	var b bytes.Buffer
+	b.WriteString("# A large generated resolv.conf.\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "nameserver 10.0.%d.%d\n", i/250, i%250)
+		fmt.Fprintf(&b, "search a%d.example b%d.example c%d.example d%d.example e%d.example f%d.example\n", i, i, i, i, i, i)
+		fmt.Fprintf(&b, "options ndots:%d timeout:%d attempts:%d rotate edns0 trust-ad   no-tld-query # comment %d\n", i%16, i%30+1, i%5+1, i)
+	}
+	return b.Bytes()
+}
+
+func TestParseLargeConfig(t *testing.T) {
+	defer func(n int64) { MaxConfigBytes = n }(MaxConfigBytes)
+	MaxConfigBytes = 1 << 20
+
+	// Larger than the read buffer, so that lines straddle refills.
+	data := bytes.Repeat(largeConfig(), 3)
+	got := ParseDnsConfig(iotest.HalfReader(bytes.NewReader(data)))
+	if want := ParseDnsConfigBytes(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDnsConfig:\ngot: %+v\nwant: %+v", got, want)
+	}
+	if want := []string{"10.0.0.0:53", "10.0.0.1:53", "10.0.0.2:53"}; !reflect.DeepEqual(got.Servers, want) {
+		t.Errorf("got servers %q; want %q", got.Servers, want)
+	}
+	if want := []string{"a199.example.", "b199.example.", "c199.example.", "d199.example.", "e199.example.", "f199.example."}; !reflect.DeepEqual(got.Search, want) {
+		t.Errorf("got search %q; want %q", got.Search, want)
+	}
+	// A line too long for the read buffer, past the start of the data,
+	// stops both readers alike.
+	data = append(largeConfig(), "search "+strings.Repeat("x", 70000)+"\n"...)
+	data = append(data, largeConfig()...)
+	got = ParseDnsConfig(iotest.HalfReader(bytes.NewReader(data)))
+	if want := ParseDnsConfigBytes(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDnsConfig with an over-long line:\ngot: %+v\nwant: %+v", got, want)
+	}
+	if !errors.Is(got.Err, bufio.ErrTooLong) {
+		t.Errorf("over-long line: got error %v; want %v", got.Err, bufio.ErrTooLong)
+	}
+}
+
+func BenchmarkParseDnsConfigBytes(b *testing.B) {
+	data := largeConfig()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		ParseDnsConfigBytes(data)
+	}
+}
+
+func TestNdotsLimits(t *testing.T) {
+	tests := []struct {
+		data string
+		want int
+	}{
+		{"options ndots:15\n", MaxNdots},
+		{"options ndots:16\n", MaxNdots},
+		{"options ndots:0\n", MinNdots},
+		{"options ndots:14\n", 14},
+	}
+	for _, tt := range tests {
+		if got := ParseDnsConfigBytes([]byte(tt.data)).Ndots; got != tt.want {
+			t.Errorf("%q: got ndots %d; want %d", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultPort(t *testing.T) {
+	defer func(port string) { DefaultPort = port }(DefaultPort)
+
+	DefaultPort = "5300"
+	conf := ParseDnsConfigBytes([]byte("nameserver 127.0.0.1\nnameserver ::1\n"))
+	if want := []string{"127.0.0.1:5300", "[::1]:5300"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+}
+
+func TestHasServers(t *testing.T) {
+	conf := dnsReadConfig("testdata/empty-resolv.conf")
+	if conf.HasServers() || conf.ServerCount() != len(defaultNS) {
+		t.Errorf("empty file: HasServers() = %v, ServerCount() = %d; want false, %d", conf.HasServers(), conf.ServerCount(), len(defaultNS))
+	}
+	conf = dnsReadConfig("testdata/crlf-resolv.conf")
+	if !conf.HasServers() || conf.ServerCount() != 2 {
+		t.Errorf("populated file: HasServers() = %v, ServerCount() = %d; want true, 2", conf.HasServers(), conf.ServerCount())
+	}
+	if conf := DefaultConfig(); conf.HasServers() {
+		t.Error("DefaultConfig().HasServers() = true; want false")
+	}
+}
+
+func TestCaseInsensitiveDirectives(t *testing.T) {
+	defer func(v bool) { CaseInsensitiveDirectives = v }(CaseInsensitiveDirectives)
+
+	conf := dnsReadConfig("testdata/mixed-case-resolv.conf")
+	if !reflect.DeepEqual(conf.Servers, defaultNS) || conf.Ndots != 1 || !conf.UnknownOpt {
+		t.Errorf("CaseInsensitiveDirectives off: got servers %q, ndots %d, unknown %v; want %q, 1, true", conf.Servers, conf.Ndots, conf.UnknownOpt, defaultNS)
+	}
+
+	CaseInsensitiveDirectives = true
+	conf = dnsReadConfig("testdata/mixed-case-resolv.conf")
+	if want := []string{"8.8.8.8:53", "8.8.4.4:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if want := []string{"example.com."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("got search %q; want %q", conf.Search, want)
+	}
+	if conf.Ndots != 2 || conf.UnknownOpt {
+		t.Errorf("got ndots %d, unknown %v; want 2, false", conf.Ndots, conf.UnknownOpt)
+	}
+}
+
+func TestMaxSearchTries(t *testing.T) {
+	conf := &DnsConfig{
+		Ndots:          1,
+		Search:         []string{"a.example.", "b.example.", "c.example.", "d.example.", "e.example.", "f.example."},
+		MaxSearchTries: 2,
+	}
+	want := []string{"host.a.example.", "host.b.example.", "host."}
+	if got := conf.nameList("host"); !reflect.DeepEqual(got, want) {
+		t.Errorf("nameList(%q) = %q; want %q", "host", got, want)
+	}
+	want = []string{"www.example.", "www.example.a.example.", "www.example.b.example."}
+	if got := conf.nameList("www.example"); !reflect.DeepEqual(got, want) {
+		t.Errorf("nameList(%q) = %q; want %q", "www.example", got, want)
+	}
+	want = []string{"a.example.", "b.example.", "."}
+	if got := conf.SearchSuffixes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchSuffixes() = %q; want %q", got, want)
+	}
+
+	conf.MaxSearchTries = 0
+	if got := conf.nameList("host"); len(got) != 7 {
+		t.Errorf("nameList(%q) with MaxSearchTries 0 = %q; want all 6 suffixes and the name", "host", got)
+	}
+}
+
+func TestAccumulateSearchLines(t *testing.T) {
+	defer func(v bool) { AccumulateSearchLines = v }(AccumulateSearchLines)
+	AccumulateSearchLines = true
+
+	conf := dnsReadConfig("testdata/multi-search-resolv.conf")
+	want := []string{"a.example.", "b.example.", "c.example.", "d.example.", "e.example.", "f.example."}
+	if !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("got search %q; want %q", conf.Search, want)
+	}
+	if len(conf.Warnings) != 1 {
+		t.Errorf("got warnings %q; want one for g.example.", conf.Warnings)
+	}
+
+	// A domain line still replaces the search list.
+	conf = dnsReadConfig("testdata/interleaved-resolv.conf")
+	if want := []string{"c.example."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("interleaved: got search %q; want %q", conf.Search, want)
+	}
+	conf = ParseDnsConfigBytes([]byte("domain a.example\nsearch b.example\nsearch c.example\n"))
+	if want := []string{"b.example.", "c.example."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("domain then search: got search %q; want %q", conf.Search, want)
+	}
+}
+
+func TestResolvedPath(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "resolv.conf.real")
+	if err := os.WriteFile(target, []byte("nameserver 8.8.8.8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if conf := dnsReadConfig(target); conf.ResolvedPath != target {
+		t.Errorf("direct read: got ResolvedPath %q; want %q", conf.ResolvedPath, target)
+	}
+
+	link := filepath.Join(dir, "resolv.conf")
+	if err := os.Symlink("resolv.conf.real", link); err != nil {
+		t.Fatal(err)
+	}
+	if conf := dnsReadConfig(link); conf.ResolvedPath != target {
+		t.Errorf("symlink: got ResolvedPath %q; want %q", conf.ResolvedPath, target)
+	}
+
+	if conf := dnsReadConfig(filepath.Join(dir, "missing")); conf.ResolvedPath != "" {
+		t.Errorf("missing file: got ResolvedPath %q; want none", conf.ResolvedPath)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	conf := dnsReadConfig("testdata/invalid-utf8-resolv.conf")
+	if !errors.Is(conf.Err, ErrInvalidUTF8) {
+		t.Errorf("got error %v; want %v", conf.Err, ErrInvalidUTF8)
+	}
+	if !reflect.DeepEqual(conf.Servers, defaultNS) || !reflect.DeepEqual(conf.Search, []string{"domain.local."}) {
+		t.Errorf("got servers %q, search %q; want the defaults", conf.Servers, conf.Search)
+	}
+
+	conf = ParseDnsConfigBytes([]byte("search m\u00fcnchen.example\n"))
+	if conf.Err != nil {
+		t.Errorf("valid UTF-8: got error %v", conf.Err)
+	}
+}
+
+func TestRewriteUnspecifiedServers(t *testing.T) {
+	defer func(v bool) { RewriteUnspecifiedServers = v }(RewriteUnspecifiedServers)
+	RewriteUnspecifiedServers = false
+
+	want := []string{"0.0.0.0:53", "[::]:53", "8.8.8.8:53"}
+	conf := dnsReadConfig("testdata/unspecified-resolv.conf")
+	if !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if servers, err := ReadServers("testdata/unspecified-resolv.conf"); err != nil || !reflect.DeepEqual(servers, want) {
+		t.Errorf("ReadServers() = %q, %v; want %q", servers, err, want)
+	}
+}
+
+func TestAllowIncludes(t *testing.T) {
+	defer func(v bool) { AllowIncludes = v }(AllowIncludes)
+
+	conf := dnsReadConfig("testdata/include-resolv.conf")
+	if want := []string{"10.0.0.1:53"}; !reflect.DeepEqual(conf.Servers, want) || !conf.UnknownOpt {
+		t.Errorf("AllowIncludes off: got servers %q, unknown %v; want %q, true", conf.Servers, conf.UnknownOpt, want)
+	}
+
+	AllowIncludes = true
+	conf = dnsReadConfig("testdata/include-resolv.conf")
+	if want := []string{"10.0.0.1:53", "10.0.0.2:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if want := []string{"example.com."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("got search %q; want %q", conf.Search, want)
+	}
+	if conf.Ndots != 2 || conf.UnknownOpt || len(conf.Warnings) != 0 {
+		t.Errorf("got ndots %d, unknown %v, warnings %q; want 2, false, none", conf.Ndots, conf.UnknownOpt, conf.Warnings)
+	}
+
+	conf = dnsReadConfig("testdata/include-self-resolv.conf")
+	if want := []string{"10.0.0.1:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("self include: got servers %q; want %q", conf.Servers, want)
+	}
+	if len(conf.Warnings) != 1 || !strings.Contains(conf.Warnings[0], errIncludeLoop.Error()) {
+		t.Errorf("self include: got warnings %q; want an include loop", conf.Warnings)
+	}
+
+	// A loop through another file is caught too.
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"a.conf": "nameserver 10.0.0.1\ninclude b.conf\n",
+		"b.conf": "nameserver 10.0.0.2\ninclude a.conf\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf = dnsReadConfig(filepath.Join(dir, "a.conf"))
+	if want := []string{"10.0.0.1:53", "10.0.0.2:53"}; !reflect.DeepEqual(conf.Servers, want) || len(conf.Warnings) != 1 {
+		t.Errorf("include loop: got servers %q, warnings %q; want %q and one warning", conf.Servers, conf.Warnings, want)
+	}
+}
+
+func TestDnsmasqCompat(t *testing.T) {
+	defer func(v bool) { DnsmasqCompat = v }(DnsmasqCompat)
+
+	conf := dnsReadConfig("testdata/dnsmasq.conf")
+	if !reflect.DeepEqual(conf.Servers, defaultNS) || !conf.UnknownOpt {
+		t.Errorf("DnsmasqCompat off: got servers %q, unknown %v; want %q, true", conf.Servers, conf.UnknownOpt, defaultNS)
+	}
+
+	DnsmasqCompat = true
+	conf = dnsReadConfig("testdata/dnsmasq.conf")
+	want := []string{"1.1.1.1:53", "9.9.9.9:5353", "[2001:4860:4860::8888]:53"}
+	if !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if !conf.UnknownOpt {
+		t.Error("got UnknownOpt false; want true for the other dnsmasq settings")
+	}
+	if len(conf.Warnings) != 1 || !strings.Contains(conf.Warnings[0], "/corp.example/") {
+		t.Errorf("got warnings %q; want one for the domain server", conf.Warnings)
+	}
+}
@@ -0,0 +1,68 @@
+package dnsconfig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"runtime"
+)
+
+// ReadDnsConfigURL reads a config in resolv.conf format from rawURL,
+// which may use the http, https or file scheme, as served by config
+// distribution systems. A body larger than MaxConfigBytes is rejected
+// with ErrConfigTooLarge. As with ReadDnsConfig, failures are reported
+// in the Err field of a config holding the defaults.
+func ReadDnsConfigURL(ctx context.Context, rawURL string) *DnsConfig {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return failedURLConfig(err)
+	}
+	switch u.Scheme {
+	case "file":
+		return dnsReadConfig(fileURLPath(u))
+	case "http", "https":
+	default:
+		return failedURLConfig(fmt.Errorf("dnsconfig: unsupported URL scheme %q", u.Scheme))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return failedURLConfig(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return failedURLConfig(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return failedURLConfig(fmt.Errorf("dnsconfig: fetching %s: %s", rawURL, resp.Status))
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, MaxConfigBytes+1))
+	if err != nil {
+		return failedURLConfig(err)
+	}
+	if int64(len(b)) > MaxConfigBytes {
+		return failedURLConfig(fmt.Errorf("dnsconfig: fetching %s: %w", rawURL, ErrConfigTooLarge))
+	}
+	return ParseDnsConfigBytes(b)
+}
+
+// fileURLPath returns the local path named by the file URL u. On
+// Windows, the path of "file:///C:/etc/resolv.conf" is C:\etc\resolv.conf.
+func fileURLPath(u *url.URL) string {
+	p := u.Path
+	if runtime.GOOS == "windows" && len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// failedURLConfig returns the default config with Err set to err.
+func failedURLConfig(err error) *DnsConfig {
+	Logger.Debugf("dnsconfig: %v", err)
+	conf := defaultConfig()
+	conf.Err = err
+	return conf
+}
@@ -0,0 +1,81 @@
+package dnsconfig
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDnsConfigURL(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/resolv.conf":
+			w.Write([]byte("nameserver 8.8.8.8\nsearch example.com\n"))
+		case "/large.conf":
+			w.Write([]byte(strings.Repeat("#", int(MaxConfigBytes)+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	conf := ReadDnsConfigURL(context.Background(), ts.URL+"/resolv.conf")
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	if want := []string{"8.8.8.8:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if want := []string{"example.com."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("got search %q; want %q", conf.Search, want)
+	}
+
+	conf = ReadDnsConfigURL(context.Background(), ts.URL+"/missing.conf")
+	if conf.Err == nil {
+		t.Error("missing file: got no error")
+	}
+	if !reflect.DeepEqual(conf.Servers, defaultNS) {
+		t.Errorf("missing file: got servers %q; want %q", conf.Servers, defaultNS)
+	}
+
+	conf = ReadDnsConfigURL(context.Background(), ts.URL+"/large.conf")
+	if !errors.Is(conf.Err, ErrConfigTooLarge) {
+		t.Errorf("large file: got error %v; want %v", conf.Err, ErrConfigTooLarge)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conf = ReadDnsConfigURL(ctx, ts.URL+"/resolv.conf")
+	if !errors.Is(conf.Err, context.Canceled) {
+		t.Errorf("canceled context: got error %v; want %v", conf.Err, context.Canceled)
+	}
+
+	abs, err := filepath.Abs("testdata/search-resolv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "file:///C:/dir" on Windows, as "file:///dir" elsewhere.
+	fileURL := &url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}
+	if !strings.HasPrefix(fileURL.Path, "/") {
+		fileURL.Path = "/" + fileURL.Path
+	}
+	conf = ReadDnsConfigURL(context.Background(), fileURL.String())
+	if conf.Err != nil {
+		t.Errorf("file URL: %v", conf.Err)
+	}
+
+	conf = ReadDnsConfigURL(context.Background(), "ftp://example.com/resolv.conf")
+	if conf.Err == nil {
+		t.Error("ftp URL: got no error")
+	}
+}
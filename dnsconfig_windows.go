@@ -5,20 +5,26 @@
 package dnsconfig
 
 import (
+	"context"
 	"net"
 	"os"
+	"strings"
 	"syscall"
-	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
 )
 
+// DefaultResolvFile is empty on Windows, which reads the DNS config
+// from the network adapters rather than from a resolv.conf file.
+var DefaultResolvFile = ""
+
 // adapterAddresses returns a list of IP adapter and address
 // structures. The structure contains an IP adapter and flattened
 // multiple IP addresses including unicast, anycast and multicast
 // addresses.
-func adapterAddresses() ([]*windows.IpAdapterAddresses, error) {
+var adapterAddresses = func() ([]*windows.IpAdapterAddresses, error) { // variable for testing
 	var b []byte
 	l := uint32(15000) // recommended initial size
 	for {
@@ -44,54 +50,185 @@ func adapterAddresses() ([]*windows.IpAdapterAddresses, error) {
 	return aas, nil
 }
 
-func dnsReadDefaultConfig() (conf *DnsConfig) {
-	conf = &DnsConfig{
-		Ndots:    1,
-		Timeout:  5 * time.Second,
-		Attempts: 2,
+// tcpipParameters is the registry key, under HKEY_LOCAL_MACHINE, holding
+// the administrator's TCP/IP settings.
+const tcpipParameters = `SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`
+
+// readRegistryString returns the string value name of the key at path
+// under HKEY_LOCAL_MACHINE.
+var readRegistryString = func(path, name string) (string, error) { // variable for testing
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
 	}
+	defer k.Close()
+	s, _, err := k.GetStringValue(name)
+	return s, err
+}
+
+// searchList returns the search domains Windows uses: the SearchList
+// set by the administrator if there is one, and otherwise the DNS
+// suffixes of the network adapters, in adapter order.
+func searchList(adapterSuffixes []string) []string {
+	var search []string
+	add := func(name string) {
+		name = ensureRooted(name)
+		if name == "." || len(search) >= maxDNSSearch {
+			return
+		}
+		for _, s := range search {
+			if strings.EqualFold(s, name) {
+				return
+			}
+		}
+		search = append(search, name)
+	}
+	if list, err := readRegistryString(tcpipParameters, "SearchList"); err == nil && list != "" {
+		for _, name := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+			add(name)
+		}
+		return search
+	}
+	for _, name := range adapterSuffixes {
+		add(name)
+	}
+	return search
+}
+
+// adapterAddressesContext is like adapterAddresses, but returns
+// ctx.Err() if ctx is done first. A nil ctx never is.
+func adapterAddressesContext(ctx context.Context) ([]*windows.IpAdapterAddresses, error) {
+	if ctx == nil || ctx.Done() == nil {
+		return adapterAddresses()
+	}
+	type result struct {
+		aas []*windows.IpAdapterAddresses
+		err error
+	}
+	c := make(chan result, 1) // buffered, so an abandoned call does not leak
+	go func() {
+		aas, err := adapterAddresses()
+		c <- result{aas, err}
+	}()
+	select {
+	case r := <-c:
+		return r.aas, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func dnsReadDefaultConfig(o *options) (conf *DnsConfig) {
+	conf = newConfig()
 	defer func() {
-		if len(conf.Servers) == 0 {
-			conf.Servers = defaultNS
+		conf.AllServers = conf.Servers
+		if o.maxServers > 0 && len(conf.Servers) > o.maxServers {
+			if o.stats != nil {
+				o.stats.ServersSkipped += len(conf.Servers) - o.maxServers
+			}
+			conf.Servers = conf.Servers[:o.maxServers:o.maxServers]
+		}
+		if o.stats != nil {
+			o.stats.ServersFound = len(conf.Servers)
+		}
+		conf.setDefaults()
+		if o.envOverrides {
+			conf.applyEnvNdots()
+		}
+		if o.stats != nil {
+			o.stats.SearchCount = len(conf.Search)
 		}
 	}()
-	aas, err := adapterAddresses()
+	aas, err := adapterAddressesContext(o.ctx)
 	if err != nil {
+		if o.ctx != nil && err == o.ctx.Err() {
+			conf.Err = err
+		}
 		return
 	}
 	// TODO(bradfitz): this just collects all the DNS servers on all
 	// the interfaces in some random order. It should order it by
 	// default route, or only use the default route(s) instead.
 	// In practice, however, it mostly works.
+	var suffixes []string
 	for _, aa := range aas {
-		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
-			// Only take interfaces whose OperStatus is IfOperStatusUp(0x01) into DNS configs.
-			if aa.OperStatus != windows.IfOperStatusUp {
-				continue
-			}
-			sa, err := dns.Address.Sockaddr.Sockaddr()
-			if err != nil {
+		// Only take interfaces whose OperStatus is IfOperStatusUp(0x01) into DNS configs.
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		if s := windows.UTF16PtrToString(aa.DnsSuffix); s != "" {
+			suffixes = append(suffixes, s)
+		}
+		conf.Servers = append(conf.Servers, adapterServers(aa)...)
+	}
+	conf.Search = searchList(suffixes)
+	return conf
+}
+
+// adapterServers returns the DNS server addresses, in host:port form,
+// configured on aa.
+func adapterServers(aa *windows.IpAdapterAddresses) []string {
+	var servers []string
+	for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+		sa, err := dns.Address.Sockaddr.Sockaddr()
+		if err != nil {
+			continue
+		}
+		var ip net.IP
+		switch sa := sa.(type) {
+		case *syscall.SockaddrInet4:
+			ip = net.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3])
+		case *syscall.SockaddrInet6:
+			ip = make(net.IP, net.IPv6len)
+			copy(ip, sa.Addr[:])
+			if ip[0] == 0xfe && ip[1] == 0xc0 {
+				// Ignore these fec0/10 ones. Windows seems to
+				// populate them as defaults on its misc rando
+				// interfaces.
 				continue
 			}
-			var ip net.IP
-			switch sa := sa.(type) {
-			case *syscall.SockaddrInet4:
-				ip = net.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3])
-			case *syscall.SockaddrInet6:
-				ip = make(net.IP, net.IPv6len)
-				copy(ip, sa.Addr[:])
-				if ip[0] == 0xfe && ip[1] == 0xc0 {
-					// Ignore these fec0/10 ones. Windows seems to
-					// populate them as defaults on its misc rando
-					// interfaces.
-					continue
-				}
-			default:
-				// Unexpected type.
-				continue
+		default:
+			// Unexpected type.
+			continue
+		}
+		servers = append(servers, net.JoinHostPort(ip.String(), DefaultPort))
+	}
+	return servers
+}
+
+// An InterfaceConfig is the DNS config of one network interface.
+type InterfaceConfig struct {
+	Name     string   // friendly name of the interface
+	Servers  []string // server addresses (in host:port form) to use
+	Suffixes []string // rooted DNS suffixes: the interface's own, then its search list
+}
+
+// ReadInterfaceConfigs returns the DNS config of each network interface
+// that is up, in adapter order, for callers that need to pick one.
+// ReadDnsConfig flattens these into a single config.
+func ReadInterfaceConfigs() ([]InterfaceConfig, error) {
+	aas, err := adapterAddresses()
+	if err != nil {
+		return nil, err
+	}
+	var ifcs []InterfaceConfig
+	for _, aa := range aas {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		ifc := InterfaceConfig{
+			Name:    windows.UTF16PtrToString(aa.FriendlyName),
+			Servers: adapterServers(aa),
+		}
+		if s := windows.UTF16PtrToString(aa.DnsSuffix); s != "" {
+			ifc.Suffixes = append(ifc.Suffixes, ensureRooted(s))
+		}
+		for sfx := aa.FirstDnsSuffix; sfx != nil; sfx = sfx.Next {
+			if s := windows.UTF16ToString(sfx.String[:]); s != "" {
+				ifc.Suffixes = append(ifc.Suffixes, ensureRooted(s))
 			}
-			conf.Servers = append(conf.Servers, net.JoinHostPort(ip.String(), "53"))
 		}
+		ifcs = append(ifcs, ifc)
 	}
-	return conf
+	return ifcs, nil
 }
@@ -0,0 +1,135 @@
+package dnsconfig
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestSearchList(t *testing.T) {
+	origReadRegistryString := readRegistryString
+	defer func() { readRegistryString = origReadRegistryString }()
+
+	suffixes := []string{"corp.example.com", "home.example"}
+	tests := []struct {
+		searchList string
+		err        error
+		want       []string
+	}{
+		{"", errors.New("not found"), []string{"corp.example.com.", "home.example."}},
+		{"", nil, []string{"corp.example.com.", "home.example."}},
+		{"a.example,b.example", nil, []string{"a.example.", "b.example."}},
+		{"a.example, B.example. b.example", nil, []string{"a.example.", "B.example."}},
+	}
+	for _, tt := range tests {
+		readRegistryString = func(path, name string) (string, error) {
+			if path != tcpipParameters || name != "SearchList" {
+				t.Fatalf("read registry value %s\\%s", path, name)
+			}
+			return tt.searchList, tt.err
+		}
+		if got := searchList(suffixes); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchList %q: got %q; want %q", tt.searchList, got, tt.want)
+		}
+	}
+}
+
+func TestReadDnsConfigContext(t *testing.T) {
+	unsetNdotsEnv(t)
+	origAdapterAddresses := adapterAddresses
+	defer func() { adapterAddresses = origAdapterAddresses }()
+	unblock := make(chan struct{})
+	defer close(unblock)
+	adapterAddresses = func() ([]*windows.IpAdapterAddresses, error) {
+		<-unblock
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	conf := ReadDnsConfigContext(ctx)
+	if conf.Err != context.DeadlineExceeded {
+		t.Errorf("got error %v; want %v", conf.Err, context.DeadlineExceeded)
+	}
+	if !reflect.DeepEqual(conf.Servers, defaultNS) {
+		t.Errorf("got servers %q; want %q", conf.Servers, defaultNS)
+	}
+}
+
+// testAdapter returns an adapter named name with the given status, DNS
+// suffix and DNS servers.
+func testAdapter(name string, status uint32, suffix string, servers ...string) *windows.IpAdapterAddresses {
+	aa := &windows.IpAdapterAddresses{
+		FriendlyName: windows.StringToUTF16Ptr(name),
+		OperStatus:   status,
+	}
+	if suffix != "" {
+		aa.DnsSuffix = windows.StringToUTF16Ptr(suffix)
+	}
+	next := &aa.FirstDnsServerAddress
+	for _, s := range servers {
+		ip := netip.MustParseAddr(s)
+		rsa := new(syscall.RawSockaddrAny)
+		if ip.Is4() {
+			sa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(rsa))
+			sa.Family = syscall.AF_INET
+			sa.Addr = ip.As4()
+		} else {
+			sa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(rsa))
+			sa.Family = syscall.AF_INET6
+			sa.Addr = ip.As16()
+		}
+		*next = &windows.IpAdapterDnsServerAdapter{
+			Address: windows.SocketAddress{Sockaddr: rsa, SockaddrLength: int32(unsafe.Sizeof(*rsa))},
+		}
+		next = &(*next).Next
+	}
+	return aa
+}
+
+func TestReadInterfaceConfigs(t *testing.T) {
+	unsetNdotsEnv(t)
+	origAdapterAddresses := adapterAddresses
+	origReadRegistryString := readRegistryString
+	defer func() {
+		adapterAddresses = origAdapterAddresses
+		readRegistryString = origReadRegistryString
+	}()
+	adapterAddresses = func() ([]*windows.IpAdapterAddresses, error) {
+		return []*windows.IpAdapterAddresses{
+			testAdapter("Ethernet", windows.IfOperStatusUp, "corp.example.com", "10.0.0.1", "2001:db8::1"),
+			testAdapter("Wi-Fi", windows.IfOperStatusDown, "home.example", "192.168.1.1"),
+			testAdapter("VPN", windows.IfOperStatusUp, "", "10.8.0.1"),
+		}, nil
+	}
+	readRegistryString = func(path, name string) (string, error) {
+		return "", errors.New("not found")
+	}
+
+	ifcs, err := ReadInterfaceConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InterfaceConfig{
+		{Name: "Ethernet", Servers: []string{"10.0.0.1:53", "[2001:db8::1]:53"}, Suffixes: []string{"corp.example.com."}},
+		{Name: "VPN", Servers: []string{"10.8.0.1:53"}},
+	}
+	if !reflect.DeepEqual(ifcs, want) {
+		t.Errorf("ReadInterfaceConfigs() = %+v; want %+v", ifcs, want)
+	}
+
+	conf := ReadDnsConfig()
+	if want := []string{"10.0.0.1:53", "[2001:db8::1]:53", "10.8.0.1:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("ReadDnsConfig() servers = %q; want %q", conf.Servers, want)
+	}
+	if want := []string{"corp.example.com."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("ReadDnsConfig() search = %q; want %q", conf.Search, want)
+	}
+}
@@ -2,4 +2,9 @@ module github.com/xjdrew/dnsconfig
 
 go 1.21.5
 
-require golang.org/x/sys v0.15.0
+require (
+	golang.org/x/net v0.19.0
+	golang.org/x/sys v0.15.0
+)
+
+require golang.org/x/text v0.14.0 // indirect
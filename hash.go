@@ -0,0 +1,54 @@
+package dnsconfig
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Hash returns a hash of the settings Diff compares, so that configs
+// for which Diff reports no differences hash alike. Mtime, Err and
+// Warnings do not contribute. The hash may change between releases.
+func (conf *DnsConfig) Hash() uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	num := func(n int64) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		h.Write(buf[:])
+	}
+	list := func(l []string) {
+		num(int64(len(l)))
+		for _, s := range l {
+			num(int64(len(s)))
+			h.Write([]byte(s))
+		}
+	}
+	flag := func(b bool) {
+		if b {
+			num(1)
+		} else {
+			num(0)
+		}
+	}
+	list(conf.Servers)
+	list(conf.DoTServers)
+	list(conf.UnresolvedServers)
+	list(conf.Search)
+	num(int64(conf.Ndots))
+	num(int64(conf.Timeout))
+	num(int64(conf.Attempts))
+	num(int64(conf.MaxSearchTries))
+	flag(conf.Rotate)
+	flag(conf.UnknownOpt)
+	list(sortOptions(conf.ExtraOptions))
+	list(conf.Lookup)
+	list(conf.NSSwitch)
+	flag(conf.SingleRequest)
+	flag(conf.SingleRequestReopen)
+	flag(conf.UseTCP)
+	flag(conf.TrustAD)
+	flag(conf.NoReload)
+	flag(conf.Insecure1)
+	flag(conf.Insecure2)
+	flag(conf.NoTLDQuery)
+	return h.Sum64()
+}
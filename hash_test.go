@@ -0,0 +1,58 @@
+package dnsconfig
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHash(t *testing.T) {
+	a := &DnsConfig{
+		Servers:  []string{"8.8.8.8:53", "8.8.4.4:53"},
+		Search:   []string{"example.com."},
+		Ndots:    1,
+		Timeout:  5 * time.Second,
+		Attempts: 2,
+	}
+	b := *a
+	b.Mtime = time.Now()
+	b.Err = errors.New("stale")
+	b.Warnings = []string{"warning"}
+	if a.Hash() != b.Hash() {
+		t.Error("configs differing only in Mtime, Err and Warnings hash differently")
+	}
+
+	c := *a
+	c.Servers = []string{"8.8.8.8:53", "1.1.1.1:53"}
+	if a.Hash() == c.Hash() {
+		t.Error("configs with different servers hash alike")
+	}
+
+	// Moving an entry from one list to the next must change the hash.
+	d := *a
+	d.Servers = []string{"8.8.8.8:53"}
+	d.DoTServers = []string{"8.8.4.4:53"}
+	if a.Hash() == d.Hash() {
+		t.Error("configs with a server moved to DoTServers hash alike")
+	}
+
+	e := *a
+	e.Rotate = true
+	if a.Hash() == e.Hash() {
+		t.Error("configs with different options hash alike")
+	}
+
+	f := *a
+	f.UnresolvedServers = []string{"a.example"}
+	g := *a
+	g.UnresolvedServers = []string{"b.example"}
+	if f.Hash() == g.Hash() {
+		t.Error("configs with different unresolved servers hash alike")
+	}
+
+	m := *a
+	m.MaxSearchTries = 1
+	if a.Hash() == m.Hash() {
+		t.Error("configs with different MaxSearchTries hash alike")
+	}
+}
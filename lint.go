@@ -0,0 +1,150 @@
+package dnsconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Severity says how serious a LintIssue is.
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // the line is accepted, but probably not as intended
+	SeverityError                   // the line, or part of it, is ignored
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A LintIssue is a problem Lint found in a resolv.conf file.
+type LintIssue struct {
+	Line     int // 1-based line number; 0 if the file could not be read
+	Severity Severity
+	Message  string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%d: %v: %s", i.Line, i.Severity, i.Message)
+}
+
+// lintFlagOptions are the options without a value that readConfig knows.
+var lintFlagOptions = map[string]bool{
+	"rotate":                true,
+	"single-request":        true,
+	"single-request-reopen": true,
+	"use-vc":                true,
+	"usevc":                 true,
+	"tcp":                   true,
+	"trust-ad":              true,
+	"no-trust-ad":           true,
+	"edns0":                 true,
+	"no-reload":             true,
+	"insecure1":             true,
+	"insecure2":             true,
+	"no-tld-query":          true,
+}
+
+// lintRanges are the ranges of the numeric options, as accepted by glibc.
+var lintRanges = map[string]struct{ min, max int }{
+	"ndots":    {MinNdots, MaxNdots},
+	"timeout":  {1, 30},
+	"attempts": {1, 5},
+	"retries":  {1, 5},
+}
+
+// Lint checks the resolv.conf file at path and returns every issue it
+// finds, in line order: invalid and duplicate name servers, servers
+// beyond the limit of 3, options out of range and unknown options and
+// directives. Lines are read as the parser reads them, following the
+// same package settings, such as AllowHostnameServers and
+// AllowIncludes; an issue in an included file is reported at the line
+// of its include directive. Unlike the parser, it reads the whole file
+// however many problems there are; a line it cannot read is reported
+// as an error.
+func Lint(path string) []LintIssue {
+	path, err := resolveSymlinks(path)
+	if err != nil {
+		return []LintIssue{{Severity: SeverityError, Message: err.Error()}}
+	}
+	file, err := open(path)
+	if err != nil {
+		return []LintIssue{{Severity: SeverityError, Message: err.Error()}}
+	}
+	defer file.close()
+	file.setLimit(MaxConfigBytes)
+
+	var issues []LintIssue
+	r := &confReader{file: file, path: path}
+	defer r.close()
+	report := func(sev Severity, format string, args ...any) {
+		issues = append(issues, LintIssue{r.line, sev, fmt.Sprintf(format, args...)})
+	}
+	r.warn = func(msg string) { report(SeverityWarning, "%s", msg) }
+	servers := &serverList{conf: new(DnsConfig), max: maxNameservers, stats: new(Stats), filename: path, report: report}
+	for f, comment, port, ok := r.next(); ok; f, comment, port, ok = r.next() {
+		switch directive(f[0]) {
+		case "nameserver":
+			servers.add(f, comment, port)
+		case "domain", "search":
+			if len(f) < 2 {
+				report(SeverityWarning, "%s without a domain", f[0])
+			}
+		case "lookup":
+		case "include":
+			switch {
+			case !AllowIncludes:
+				report(SeverityWarning, "unknown directive %q", f[0])
+			case len(f) < 2:
+				report(SeverityError, "include with no file name")
+			default:
+				if err := r.include(f[1]); err != nil {
+					report(SeverityError, "cannot include %q: %v", f[1], err)
+				}
+			}
+		case "options":
+			for _, s := range joinOptionValues(f[1:]) {
+				name, value, hasValue := strings.Cut(s, ":")
+				if r, ok := lintRanges[name]; ok && hasValue {
+					v := value
+					neg := hasPrefix(v, "-")
+					if neg {
+						v = v[1:]
+					}
+					d, i, ok := dtoi(v)
+					if neg {
+						d = -d
+					}
+					switch {
+					case !ok || i != len(v):
+						report(SeverityError, "invalid value for option %s: %q", name, value)
+					case d < r.min || d > r.max:
+						report(SeverityWarning, "option %s out of range %d to %d: %s", name, r.min, r.max, value)
+					}
+					continue
+				}
+				if !hasValue && lintFlagOptions[s] {
+					continue
+				}
+				report(SeverityWarning, "unknown option %q", s)
+			}
+		default:
+			report(SeverityWarning, "unknown directive %q", f[0])
+		}
+	}
+	if r.err != nil {
+		line := r.line
+		if r.err != ErrInvalidUTF8 {
+			// The line that could not be read was not counted.
+			line++
+		}
+		issues = append(issues, LintIssue{line, SeverityError, "cannot read the rest of the file: " + r.err.Error()})
+	}
+	return issues
+}
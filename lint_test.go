@@ -0,0 +1,97 @@
+package dnsconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	want := []LintIssue{
+		{3, SeverityWarning, "duplicate nameserver 10.0.0.1"},
+		{4, SeverityError, `invalid nameserver address "bogus"`},
+		{7, SeverityWarning, "option ndots out of range 0 to 15: 20"},
+		{7, SeverityWarning, "option timeout out of range 1 to 30: 0"},
+		{7, SeverityError, `invalid value for option attempts: "x"`},
+		{7, SeverityWarning, `unknown option "frobnicate"`},
+		{8, SeverityWarning, `unknown directive "sortlist"`},
+	}
+	if got := Lint("testdata/messy-resolv.conf"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got issues:\n%v\nwant:\n%v", got, want)
+	}
+
+	if got := Lint("testdata/crlf-resolv.conf"); len(got) != 0 {
+		t.Errorf("testdata/crlf-resolv.conf: got issues %v; want none", got)
+	}
+
+	// A repeated server does not count against the limit of three.
+	name := filepath.Join(t.TempDir(), "resolv.conf")
+	data := "nameserver 8.8.8.8\nnameserver 1.1.1.1\nnameserver 8.8.8.8\nnameserver 9.9.9.9\nnameserver 10.0.0.1\n"
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want = []LintIssue{
+		{3, SeverityWarning, "duplicate nameserver 8.8.8.8"},
+		{5, SeverityWarning, "too many nameservers; only the first 3 are used"},
+	}
+	if got := Lint(name); !reflect.DeepEqual(got, want) {
+		t.Errorf("repeated server: got issues %v; want %v", got, want)
+	}
+
+	// Lines are read following the same settings as the parser.
+	dir := t.TempDir()
+	name = filepath.Join(dir, "resolv.conf")
+	data = "nameserver dns.internal\nnameserver 8.8.8.8,8.8.4.4\nserver=1.1.1.1\nserver=/corp/10.0.0.1\ninclude frag.conf\n"
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "frag.conf"), []byte("nameserver 8.8.8.8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want = []LintIssue{
+		{1, SeverityError, `invalid nameserver address "dns.internal"`},
+		{2, SeverityError, `invalid nameserver address "8.8.8.8,8.8.4.4"`},
+		{3, SeverityWarning, `unknown directive "server=1.1.1.1"`},
+		{4, SeverityWarning, `unknown directive "server=/corp/10.0.0.1"`},
+		{5, SeverityWarning, `unknown directive "include"`},
+	}
+	if got := Lint(name); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings off: got issues:\n%v\nwant:\n%v", got, want)
+	}
+	defer func(hostnames, split, dnsmasq, includes bool) {
+		AllowHostnameServers, SplitCommaSeparatedServers, DnsmasqCompat, AllowIncludes = hostnames, split, dnsmasq, includes
+	}(AllowHostnameServers, SplitCommaSeparatedServers, DnsmasqCompat, AllowIncludes)
+	AllowHostnameServers, SplitCommaSeparatedServers, DnsmasqCompat, AllowIncludes = true, true, true, true
+	want = []LintIssue{
+		{4, SeverityWarning, `unsupported dnsmasq server "server=/corp/10.0.0.1"`},
+		{5, SeverityWarning, "duplicate nameserver 8.8.8.8"},
+	}
+	if got := Lint(name); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings on: got issues:\n%v\nwant:\n%v", got, want)
+	}
+	AllowHostnameServers, SplitCommaSeparatedServers, DnsmasqCompat, AllowIncludes = false, false, false, false
+
+	got := Lint("testdata/empty-quoted-resolv.conf")
+	want = []LintIssue{{3, SeverityWarning, "search without a domain"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("testdata/empty-quoted-resolv.conf: got issues %v; want %v", got, want)
+	}
+
+	// A line too long to read is reported, not taken as the end of the file.
+	name = filepath.Join(t.TempDir(), "resolv.conf")
+	data = "nameserver 8.8.8.8\n# " + strings.Repeat("x", 64<<10) + "\nnameserver bogus\n"
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got = Lint(name)
+	if len(got) != 1 || got[0].Line != 2 || got[0].Severity != SeverityError {
+		t.Errorf("line too long: got issues %v; want one error on line 2", got)
+	}
+
+	got = Lint("a-nonexistent-file")
+	if len(got) != 1 || got[0].Line != 0 || got[0].Severity != SeverityError {
+		t.Errorf("missing file: got issues %v; want one error", got)
+	}
+}
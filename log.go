@@ -0,0 +1,21 @@
+package dnsconfig
+
+// A DebugLogger receives debug events from the config readers.
+type DebugLogger interface {
+	Debugf(format string, args ...any)
+}
+
+// Logger receives debug events, such as skipped name servers, while the
+// config is read. The default Logger discards them.
+var Logger DebugLogger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...any) {}
+
+// debugging reports whether Logger records debug events, so that busy
+// code can skip building the arguments of events that would be dropped.
+func debugging() bool {
+	_, nop := Logger.(nopLogger)
+	return !nop
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package dnsconfig
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+type testLogger []string
+
+func (l *testLogger) Debugf(format string, args ...any) {
+	*l = append(*l, fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	origLogger := Logger
+	defer func() { Logger = origLogger }()
+	var logs testLogger
+	Logger = &logs
+
+	name := t.TempDir() + "/resolv.conf"
+	if err := os.WriteFile(name, []byte("nameserver 8.8.8.8\nnameserver dns.example\noptions rotate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dnsReadConfig(name)
+	want := []string{
+		"dnsconfig: reading " + name,
+		"dnsconfig: " + name + `: skipping nameserver "dns.example": not an IP address`,
+		"dnsconfig: " + name + `: option "rotate"`,
+	}
+	if got := strings.Join(logs, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got logs:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
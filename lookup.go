@@ -0,0 +1,63 @@
+package dnsconfig
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A LookupSource is a database named in the OpenBSD "lookup" directive.
+type LookupSource int
+
+const (
+	LookupBind LookupSource = iota + 1 // query the name servers
+	LookupFile                         // search /etc/hosts
+	LookupYP                           // query the YP/NIS server
+)
+
+var lookupSourceNames = map[string]LookupSource{
+	"bind": LookupBind,
+	"file": LookupFile,
+	"yp":   LookupYP,
+}
+
+// nssSourceNames maps the NSS sources of nsswitch.conf to the databases
+// they consult.
+var nssSourceNames = map[string]LookupSource{
+	"dns":   LookupBind,
+	"files": LookupFile,
+	"nis":   LookupYP,
+}
+
+func (s LookupSource) String() string {
+	for name, v := range lookupSourceNames {
+		if v == s {
+			return name
+		}
+	}
+	return "LookupSource(" + strconv.Itoa(int(s)) + ")"
+}
+
+// LookupOrder returns the databases in Lookup, in the order they are
+// to be tried. It returns an error if Lookup names an unknown database.
+// If Lookup is empty, the order is taken from NSSwitch instead, leaving
+// out NSS sources other than "dns", "files" and "nis".
+func (conf *DnsConfig) LookupOrder() ([]LookupSource, error) {
+	if len(conf.Lookup) == 0 && len(conf.NSSwitch) > 0 {
+		var order []LookupSource
+		for _, name := range conf.NSSwitch {
+			if s, ok := nssSourceNames[name]; ok {
+				order = append(order, s)
+			}
+		}
+		return order, nil
+	}
+	order := make([]LookupSource, 0, len(conf.Lookup))
+	for _, name := range conf.Lookup {
+		s, ok := lookupSourceNames[name]
+		if !ok {
+			return nil, fmt.Errorf("dnsconfig: invalid lookup database %q", name)
+		}
+		order = append(order, s)
+	}
+	return order, nil
+}
@@ -0,0 +1,246 @@
+package dnsconfig
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	errServerMisbehaving = errors.New("server misbehaving")
+	errLameReferral      = errors.New("lame referral")
+	errNoServers         = errors.New("no DNS servers configured")
+)
+
+// LookupHost looks up the IPv4 and IPv6 addresses of name using the
+// servers and search list of conf rather than the system resolver. It
+// tries the names of NameListDetailed in order and returns the
+// addresses of the first that has any. Servers are queried in turn,
+// starting with NextServer, over TCP if UseTCP is set, each given
+// PerAttemptTimeout to answer, for up to Attempts passes.
+func (conf *DnsConfig) LookupHost(ctx context.Context, name string) ([]netip.Addr, error) {
+	if len(conf.Servers) == 0 {
+		return nil, &net.DNSError{Err: errNoServers.Error(), Name: name}
+	}
+	var lastErr error
+	for _, c := range conf.NameListDetailed(name) {
+		addrs, err := conf.lookupFQDN(ctx, c.FQDN)
+		if len(addrs) > 0 {
+			return addrs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, &net.DNSError{Err: ctx.Err().Error(), Name: name, IsTimeout: errors.Is(ctx.Err(), context.DeadlineExceeded)}
+		}
+		if err != nil && !isNotFound(err) {
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// lookupFQDN returns the A and AAAA records of the rooted name fqdn.
+func (conf *DnsConfig) lookupFQDN(ctx context.Context, fqdn string) ([]netip.Addr, error) {
+	addrs, err := conf.exchange(ctx, fqdn, dnsmessage.TypeA)
+	if err != nil && isNotFound(err) {
+		// The name does not exist, so it has no AAAA records either.
+		return nil, err
+	}
+	addrs6, err6 := conf.exchange(ctx, fqdn, dnsmessage.TypeAAAA)
+	addrs = append(addrs, addrs6...)
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+	if err == nil {
+		err = err6
+	}
+	return addrs, err
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// exchange asks the servers in turn for the records of type qtype for
+// fqdn, returning the addresses in the first usable answer.
+func (conf *DnsConfig) exchange(ctx context.Context, fqdn string, qtype dnsmessage.Type) ([]netip.Addr, error) {
+	q, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return nil, &net.DNSError{Err: "no such host", Name: fqdn, IsNotFound: true}
+	}
+	network := "udp"
+	if conf.UseTCP {
+		network = "tcp"
+	}
+	servers := conf.Servers
+	if i := slices.Index(servers, conf.NextServer()); i > 0 {
+		servers = append(slices.Clone(servers[i:]), servers[:i]...)
+	}
+	timeout := conf.PerAttemptTimeout()
+	var lastErr error
+	for i := 0; i < max(conf.Attempts, 1); i++ {
+		for _, server := range servers {
+			addrs, h, err := query(ctx, network, server, timeout, q, qtype)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				dnsErr := &net.DNSError{Err: err.Error(), Name: fqdn, Server: server}
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					dnsErr.IsTimeout = true
+				}
+				lastErr = dnsErr
+				continue
+			}
+			switch h.RCode {
+			case dnsmessage.RCodeSuccess:
+				if len(addrs) == 0 && !h.Authoritative && !h.RecursionAvailable {
+					lastErr = &net.DNSError{Err: errLameReferral.Error(), Name: fqdn, Server: server}
+					continue
+				}
+				return addrs, nil
+			case dnsmessage.RCodeNameError:
+				return nil, &net.DNSError{Err: "no such host", Name: fqdn, Server: server, IsNotFound: true}
+			default:
+				lastErr = &net.DNSError{Err: errServerMisbehaving.Error(), Name: fqdn, Server: server, IsTemporary: true}
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// query sends one query for name and qtype to server over network and
+// returns the A and AAAA records in the answer. A truncated UDP answer
+// is retried over TCP. UDP replies that do not answer the query, as an
+// off-path attacker's may not, are ignored.
+func query(ctx context.Context, network, server string, timeout time.Duration, name dnsmessage.Name, qtype dnsmessage.Type) ([]netip.Addr, dnsmessage.Header, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// A random ID makes a spoofed reply hard to forge.
+	var idb [2]byte
+	if _, err := rand.Read(idb[:]); err != nil {
+		return nil, dnsmessage.Header{}, err
+	}
+	id := binary.BigEndian.Uint16(idb[:])
+	q := dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}
+	b := dnsmessage.NewBuilder(make([]byte, 2, 514), dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, dnsmessage.Header{}, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, dnsmessage.Header{}, err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, dnsmessage.Header{}, err
+	}
+	binary.BigEndian.PutUint16(msg, uint16(len(msg)-2))
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, dnsmessage.Header{}, err
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+	defer stop()
+
+	var p dnsmessage.Parser
+	var h dnsmessage.Header
+	if network == "tcp" {
+		// Over TCP, each message is preceded by its length.
+		if _, err := c.Write(msg); err != nil {
+			return nil, dnsmessage.Header{}, err
+		}
+		var l [2]byte
+		if _, err := io.ReadFull(c, l[:]); err != nil {
+			return nil, dnsmessage.Header{}, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(c, resp); err != nil {
+			return nil, dnsmessage.Header{}, err
+		}
+		if h, err = p.Start(resp); err != nil {
+			return nil, h, err
+		}
+		if !answers(&p, h, id, q) {
+			return nil, h, errServerMisbehaving
+		}
+	} else {
+		if _, err := c.Write(msg[2:]); err != nil {
+			return nil, dnsmessage.Header{}, err
+		}
+		resp := make([]byte, 512)
+		for {
+			n, err := c.Read(resp)
+			if err != nil {
+				return nil, dnsmessage.Header{}, err
+			}
+			if h, err = p.Start(resp[:n]); err == nil && answers(&p, h, id, q) {
+				break
+			}
+		}
+	}
+
+	if h.Truncated && network == "udp" {
+		return query(ctx, "tcp", server, timeout, name, qtype)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, h, err
+	}
+	var addrs []netip.Addr
+	for {
+		ah, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, h, err
+		}
+		switch ah.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return nil, h, err
+			}
+			addrs = append(addrs, netip.AddrFrom4(r.A))
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return nil, h, err
+			}
+			addrs = append(addrs, netip.AddrFrom16(r.AAAA))
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return nil, h, err
+			}
+		}
+	}
+	return addrs, h, nil
+}
+
+// answers reports whether the response h, whose questions p is about to
+// parse, is the reply to the query with the given id and question. Names
+// are compared without regard to case, which servers may change.
+func answers(p *dnsmessage.Parser, h dnsmessage.Header, id uint16, q dnsmessage.Question) bool {
+	if h.ID != id || !h.Response {
+		return false
+	}
+	rq, err := p.Question()
+	return err == nil && rq.Type == q.Type && rq.Class == q.Class &&
+		strings.EqualFold(rq.Name.String(), q.Name.String())
+}
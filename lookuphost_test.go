@@ -0,0 +1,241 @@
+package dnsconfig
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testRecords are the records served by testResponse.
+var testRecords = map[string][]netip.Addr{
+	"host.example.com.": {netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")},
+	"www.example.net.":  {netip.MustParseAddr("192.0.2.2")},
+}
+
+// testResponse returns the answer to the query req from testRecords.
+func testResponse(t *testing.T, req []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil {
+		t.Errorf("bad query: %v", err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Errorf("bad query: %v", err)
+		return nil
+	}
+	rh := dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RecursionAvailable: true}
+	addrs, ok := testRecords[q.Name.String()]
+	if !ok {
+		rh.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, rh)
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	for _, a := range addrs {
+		rr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		switch {
+		case q.Type == dnsmessage.TypeA && a.Is4():
+			b.AResource(rr, dnsmessage.AResource{A: a.As4()})
+		case q.Type == dnsmessage.TypeAAAA && a.Is6():
+			b.AAAAResource(rr, dnsmessage.AAAAResource{AAAA: a.As16()})
+		}
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		t.Error(err)
+	}
+	return resp
+}
+
+// serveUDP answers queries on a local UDP port until the test ends and
+// returns its address.
+func serveUDP(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		var buf [512]byte
+		for {
+			n, addr, err := pc.ReadFrom(buf[:])
+			if err != nil {
+				return
+			}
+			pc.WriteTo(testResponse(t, buf[:n]), addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// serveTCP answers queries on a local TCP port until the test ends and
+// returns its address.
+func serveTCP(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				var l [2]byte
+				if _, err := io.ReadFull(c, l[:]); err != nil {
+					return
+				}
+				req := make([]byte, binary.BigEndian.Uint16(l[:]))
+				if _, err := io.ReadFull(c, req); err != nil {
+					return
+				}
+				resp := testResponse(t, req)
+				binary.BigEndian.PutUint16(l[:], uint16(len(resp)))
+				c.Write(append(l[:], resp...))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestLookupHost(t *testing.T) {
+	for _, useTCP := range []bool{false, true} {
+		network, server := "udp", serveUDP(t)
+		if useTCP {
+			network, server = "tcp", serveTCP(t)
+		}
+		conf := &DnsConfig{
+			// Nothing listens at the first server, so each query
+			// falls back to the second.
+			Servers:  []string{closedAddr(t, network), server},
+			Search:   []string{"example.com.", "example.net."},
+			Ndots:    1,
+			Timeout:  time.Second,
+			Attempts: 1,
+			UseTCP:   useTCP,
+		}
+		tests := []struct {
+			name string
+			want []netip.Addr
+		}{
+			{"host", testRecords["host.example.com."]},
+			{"www", testRecords["www.example.net."]},
+			{"host.example.com.", testRecords["host.example.com."]},
+		}
+		for _, tt := range tests {
+			got, err := conf.LookupHost(context.Background(), tt.name)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UseTCP %v: LookupHost(%q) = %v, %v; want %v", useTCP, tt.name, got, err, tt.want)
+			}
+		}
+		_, err := conf.LookupHost(context.Background(), "missing")
+		if !isNotFound(err) {
+			t.Errorf("UseTCP %v: LookupHost(%q) error = %v; want not found", useTCP, "missing", err)
+		}
+	}
+}
+
+// spoof returns a reply to the query req with its ID changed by
+// idDelta and, if name is not empty, its question and answers about name.
+func spoof(t *testing.T, req []byte, idDelta uint16, name string) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	if name != "" {
+		q.Name = dnsmessage.MustNewName(name)
+	}
+	h.ID += idDelta
+	h.Response = true
+	b := dnsmessage.NewBuilder(nil, h)
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: [4]byte{203, 0, 113, 1}})
+	resp, err := b.Finish()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	return resp
+}
+
+func TestQueryIgnoresSpoofedReplies(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		var buf [512]byte
+		for {
+			n, addr, err := pc.ReadFrom(buf[:])
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			// Replies with the wrong ID and the wrong question come
+			// first, as if from an off-path attacker.
+			pc.WriteTo(spoof(t, req, 1, ""), addr)
+			pc.WriteTo(spoof(t, req, 0, "evil.example."), addr)
+			pc.WriteTo(testResponse(t, req), addr)
+		}
+	}()
+
+	name := dnsmessage.MustNewName("www.example.net.")
+	got, _, err := query(context.Background(), "udp", pc.LocalAddr().String(), time.Second, name, dnsmessage.TypeA)
+	if want := testRecords["www.example.net."]; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("query = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestQueryRejectsMismatchedTCPReply(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var l [2]byte
+			if _, err := io.ReadFull(c, l[:]); err == nil {
+				req := make([]byte, binary.BigEndian.Uint16(l[:]))
+				if _, err := io.ReadFull(c, req); err == nil {
+					resp := spoof(t, req, 0, "evil.example.")
+					binary.BigEndian.PutUint16(l[:], uint16(len(resp)))
+					c.Write(append(l[:], resp...))
+				}
+			}
+			c.Close()
+		}
+	}()
+
+	name := dnsmessage.MustNewName("www.example.net.")
+	if got, _, err := query(context.Background(), "tcp", ln.Addr().String(), time.Second, name, dnsmessage.TypeA); err != errServerMisbehaving {
+		t.Errorf("query = %v, %v; want %v", got, err, errServerMisbehaving)
+	}
+}
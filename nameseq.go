@@ -0,0 +1,47 @@
+//go:build go1.23
+
+package dnsconfig
+
+import "iter"
+
+// NameSeq returns the names to query for name, in the same order as
+// NameListDetailed, computing each one only when the caller asks for
+// it. A caller that stops after the first name that resolves does no
+// work for the rest of the search list.
+func (conf *DnsConfig) NameSeq(name string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		// Check name length (see isDomainName).
+		l := len(name)
+		rooted := l > 0 && name[l-1] == '.'
+		if l > 254 || l == 254 && !rooted {
+			return
+		}
+
+		// If name is rooted (trailing dot), try only that name.
+		if rooted {
+			if !avoidDNS(name) {
+				yield(name)
+			}
+			return
+		}
+
+		hasNdots := conf.IsAbsolute(name)
+		name := name + "."
+
+		// If name has enough dots, try unsuffixed first.
+		if hasNdots && !avoidDNS(name) && !yield(name) {
+			return
+		}
+		// Try suffixes that are not too long (see isDomainName).
+		for _, suffix := range conf.searchTries() {
+			fqdn := name + suffix
+			if !avoidDNS(fqdn) && len(fqdn) <= 254 && !yield(fqdn) {
+				return
+			}
+		}
+		// Try unsuffixed, if not tried first above.
+		if !hasNdots && !avoidDNS(name) {
+			yield(name)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//go:build go1.23
+
+package dnsconfig
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNameSeq(t *testing.T) {
+	conf := &DnsConfig{Ndots: 1, Search: []string{"example.com.", "example.net.", "onion."}}
+	for _, name := range []string{"host", "www.example", "host.", "x.onion.", "", string(make([]byte, 254))} {
+		got := slices.Collect(conf.NameSeq(name))
+		if want := conf.nameList(name); !slices.Equal(got, want) {
+			t.Errorf("NameSeq(%q) = %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestNameSeqStopsEarly(t *testing.T) {
+	conf := &DnsConfig{Ndots: 5, Search: []string{"a.example.", "b.example.", "c.example.", "d.example.", "e.example.", "f.example."}}
+	var first string
+	allocs := testing.AllocsPerRun(100, func() {
+		for name := range conf.NameSeq("host") {
+			first = name
+			break
+		}
+	})
+	if first != "host.a.example." {
+		t.Errorf("first name = %q; want %q", first, "host.a.example.")
+	}
+	// Two strings are built for the first name: "host." and the suffixed
+	// name. Computing the rest of the search list would take more.
+	if full := testing.AllocsPerRun(100, func() { conf.nameList("host") }); allocs >= full || allocs > 2 {
+		t.Errorf("stopping after one name made %v allocations (nameList makes %v); want at most 2", allocs, full)
+	}
+}
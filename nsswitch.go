@@ -0,0 +1,43 @@
+package dnsconfig
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// ReadNSSwitch returns the sources listed on the hosts line of the
+// nsswitch.conf file at path, in the order they are consulted, as in
+// ["files", "dns"]. Actions such as "[NOTFOUND=return]" are left out.
+// It returns nil if the file has no hosts line, and an error if the
+// file cannot be read to the end.
+func ReadNSSwitch(path string) ([]string, error) {
+	r, err := OpenLineReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var sources []string
+	for line, ok := r.ReadLine(); ok; line, ok = r.ReadLine() {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		db, list, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(db) != "hosts" {
+			continue
+		}
+		sources = nil // the last hosts line wins, as in glibc
+		inAction := false
+		for _, s := range getFields(list) {
+			switch {
+			case inAction || s[0] == '[':
+				inAction = s[len(s)-1] != ']'
+			default:
+				sources = append(sources, s)
+			}
+		}
+	}
+	if err := r.Err(); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: err}
+	}
+	return sources, nil
+}
@@ -0,0 +1,52 @@
+package dnsconfig
+
+import (
+	"context"
+	"io"
+	"io/fs"
+)
+
+// An Option changes how ReadDnsConfig reads the system DNS config.
+type Option func(*options)
+
+type options struct {
+	file         string          // config file; empty means DefaultResolvFile
+	fsys         fs.FS           // file system holding file; nil means the OS
+	reader       io.Reader       // if non-nil, read instead of opening file
+	data         []byte          // if non-nil, parse instead of reading file
+	envOverrides bool            // apply environment overrides such as NdotsEnv to the system config
+	maxServers   int             // name servers to keep; 0 means the platform default
+	stats        *Stats          // if non-nil, filled in while reading
+	nsswitch     string          // nsswitch.conf to fill NSSwitch from, if non-empty
+	ctx          context.Context // if non-nil, bounds slow system calls
+}
+
+func defaultOptions() *options {
+	return &options{envOverrides: true}
+}
+
+// WithFile reads the config from path instead of DefaultResolvFile.
+// It has no effect on Windows, which has no resolv.conf.
+func WithFile(path string) Option {
+	return func(o *options) { o.file = path }
+}
+
+// WithEnvOverrides sets whether environment variables such as NdotsEnv
+// may override the system config. They may by default.
+func WithEnvOverrides(on bool) Option {
+	return func(o *options) { o.envOverrides = on }
+}
+
+// WithMaxServers sets the maximum number of name servers kept. By default
+// three are kept on Unix, as libc does, and all of them on Windows.
+func WithMaxServers(n int) Option {
+	return func(o *options) { o.maxServers = n }
+}
+
+// WithNSSwitch fills NSSwitch from the hosts line of the nsswitch.conf
+// file at path, such as "/etc/nsswitch.conf", which governs the lookup
+// order on Linux. NSSwitch then holds the names of the NSS sources, as
+// in "files" and "dns". It has no effect on Windows.
+func WithNSSwitch(path string) Option {
+	return func(o *options) { o.nsswitch = path }
+}
@@ -8,58 +8,130 @@
 package dnsconfig
 
 import (
+	"bufio"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 )
 
 type file struct {
-	file  *os.File
-	data  []byte
+	file  io.Reader
+	buf   []byte // read buffer
+	data  []byte // unread part of buf
 	atEOF bool
+	err   error // read error other than EOF, bufio.ErrTooLong or ErrConfigTooLarge
+	max   int64 // bytes that may be read; 0 means no limit
+	n     int64 // bytes read so far
 }
 
-func (f *file) close() { f.file.Close() }
+// bufSize is the size of the read buffer. A line, with its line ending,
+// must fit in it.
+const bufSize = 64 << 10
+
+func newFile(r io.Reader) *file {
+	buf := make([]byte, bufSize)
+	return &file{file: r, buf: buf, data: buf[:0]}
+}
+
+// newFileBytes returns a file reading lines from b, which it does not
+// modify or copy. Lines too long for the read buffer of newFile are
+// refused all the same, so that both read the same lines.
+func newFileBytes(b []byte) *file {
+	return &file{data: b, atEOF: true}
+}
+
+func (f *file) close() error {
+	if c, ok := f.file.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
 
 func (f *file) getLineFromData() (s string, ok bool) {
 	data := f.data
-	i := 0
-	for i = 0; i < len(data); i++ {
+	for i := 0; i < len(data); i++ {
 		if data[i] == '\n' {
-			s = string(data[0:i])
-			ok = true
-			// move data
-			i++
-			n := len(data) - i
-			copy(data[0:], data[i:])
-			f.data = data[0:n]
-			return
+			if i >= bufSize {
+				return f.tooLong()
+			}
+			s = string(trimCR(data[0:i]))
+			// Advance past the line rather than moving the rest of
+			// the data, which would make reading quadratic.
+			f.data = data[i+1:]
+			return s, true
 		}
 	}
 	if f.atEOF && len(f.data) > 0 {
+		if len(data) >= bufSize {
+			return f.tooLong()
+		}
 		// EOF, return all we have
-		s = string(data)
-		f.data = f.data[0:0]
+		s = string(trimCR(data))
+		f.data = data[len(data):]
 		ok = true
 	}
 	return
 }
 
+// setLimit makes reading fail with ErrConfigTooLarge once more than max
+// bytes are read.
+func (f *file) setLimit(max int64) {
+	f.max = max
+	if f.file == nil && int64(len(f.data)) > max {
+		f.stop(ErrConfigTooLarge)
+	}
+}
+
+// tooLong stops reading at a line that does not fit in the read buffer.
+func (f *file) tooLong() (string, bool) {
+	f.stop(bufio.ErrTooLong)
+	return "", false
+}
+
+// stop ends reading with err.
+func (f *file) stop(err error) {
+	f.err = err
+	f.data = nil
+	f.atEOF = true
+}
+
+// trimCR removes a trailing carriage return left by CRLF line endings.
+func trimCR(b []byte) []byte {
+	if len(b) > 0 && b[len(b)-1] == '\r' {
+		return b[:len(b)-1]
+	}
+	return b
+}
+
 func (f *file) readLine() (s string, ok bool) {
 	if s, ok = f.getLineFromData(); ok {
 		return
 	}
-	if len(f.data) < cap(f.data) {
-		ln := len(f.data)
-		n, err := io.ReadFull(f.file, f.data[ln:cap(f.data)])
-		if n >= 0 {
-			f.data = f.data[0 : ln+n]
+	if !f.atEOF && len(f.data) < len(f.buf) {
+		// Move the partial line to the start of buf and fill the rest.
+		ln := copy(f.buf, f.data)
+		n, err := io.ReadFull(f.file, f.buf[ln:])
+		f.data = f.buf[0 : ln+n]
+		f.n += int64(n)
+		if f.max > 0 && f.n > f.max {
+			f.stop(ErrConfigTooLarge)
+			return "", false
 		}
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			f.atEOF = true
+		} else if err != nil {
+			f.err = err
+			f.atEOF = true
 		}
 	}
 	s, ok = f.getLineFromData()
+	if !ok && !f.atEOF {
+		// buf is full, but holds no whole line.
+		return f.tooLong()
+	}
 	return
 }
 
@@ -68,7 +140,78 @@ func open(name string) (*file, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &file{fd, make([]byte, 0, 64*1024), false}, nil
+	return newFile(fd), nil
+}
+
+// A LineReader reads a file one line at a time through a fixed 64KiB
+// buffer. It is the reader used for resolv.conf.
+type LineReader struct {
+	f *file
+}
+
+// OpenLineReader opens the named file for reading lines.
+func OpenLineReader(path string) (*LineReader, error) {
+	f, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &LineReader{f}, nil
+}
+
+// ReadLine returns the next line without its line ending, which may be
+// "\n" or "\r\n". The last line need not end in a newline. ok is false at
+// the end of the file, or if reading stopped early, as reported by Err.
+func (r *LineReader) ReadLine() (s string, ok bool) {
+	return r.f.readLine()
+}
+
+// Err returns the error that stopped ReadLine before the end of the
+// file: a read error, or bufio.ErrTooLong if a line does not fit in
+// the buffer. It returns nil if the whole file was read.
+func (r *LineReader) Err() error {
+	return r.f.err
+}
+
+// Close closes the underlying file.
+func (r *LineReader) Close() error {
+	return r.f.close()
+}
+
+// maxSymlinks bounds the symbolic links followed by resolveSymlinks,
+// as MAXSYMLINKS does on Linux.
+const maxSymlinks = 40
+
+// resolveSymlinks follows the chain of symbolic links at name and
+// returns the path of the file it ends at. A chain longer than
+// maxSymlinks is reported as a loop.
+func resolveSymlinks(name string) (string, error) {
+	path := name
+	for i := 0; i <= maxSymlinks; i++ {
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			return path, nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+	return "", &fs.PathError{Op: "open", Path: name, Err: syscall.ELOOP}
+}
+
+func openFS(fsys fs.FS, name string) (*file, error) {
+	fd, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return newFile(fd), nil
 }
 
 // Count occurrences in s of any bytes in t.
@@ -103,7 +246,55 @@ func splitAtBytes(s string, t string) []string {
 	return a[0:n]
 }
 
-func getFields(s string) []string { return splitAtBytes(s, " \r\t\n") }
+// getFields splits s into whitespace-separated fields, removing the
+// double quotes around any quoted field. A quoted empty field, "", is
+// dropped.
+func getFields(s string) []string {
+	f := splitAtBytes(s, " \r\t\n")
+	n := 0
+	for _, field := range f {
+		if field = unquoteField(field); field != "" {
+			f[n] = field
+			n++
+		}
+	}
+	return f[:n]
+}
+
+// appendFields appends the fields of s, as returned by getFields, to dst.
+func appendFields(dst []string, s string) []string {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == ' ' || c == '\r' || c == '\t' || c == '\n' {
+			if last < i {
+				dst = appendField(dst, s[last:i])
+			}
+			last = i + 1
+		}
+	}
+	if last < len(s) {
+		dst = appendField(dst, s[last:])
+	}
+	return dst
+}
+
+// appendField appends f, unquoted, to dst unless it is empty.
+func appendField(dst []string, f string) []string {
+	if f = unquoteField(f); f != "" {
+		dst = append(dst, f)
+	}
+	return dst
+}
+
+// unquoteField returns f without the double quotes around it, if it
+// has them. Quotes are not otherwise special: a quoted field cannot
+// contain spaces.
+func unquoteField(f string) string {
+	if len(f) >= 2 && f[0] == '"' && f[len(f)-1] == '"' {
+		return f[1 : len(f)-1]
+	}
+	return f
+}
 
 // Bigger than we need, not too big to worry about overflow
 const big = 0xFFFFFF
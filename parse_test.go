@@ -0,0 +1,57 @@
+package dnsconfig
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 60<<10)
+	tests := []struct {
+		data string
+		want []string
+		err  error
+	}{
+		{"a\nb\r\n\nc", []string{"a", "b", "", "c"}, nil},
+		// Only the one carriage return ending a line is removed,
+		// including from a last line without a newline.
+		{"a\r\nb\r\n", []string{"a", "b"}, nil},
+		{"a\r\nb\r", []string{"a", "b"}, nil},
+		{"\r\n\r", []string{"", ""}, nil},
+		{"a\r\r\nb\rc\r\n", []string{"a\r", "b\rc"}, nil},
+		{"a\nb\n", []string{"a", "b"}, nil},
+		{"", nil, nil},
+		{long + "\nb\n", []string{long, "b"}, nil},
+		{"a\n" + long + long + "\nb\n", []string{"a"}, bufio.ErrTooLong}, // line too long for the buffer
+	}
+	for i, tt := range tests {
+		name := t.TempDir() + "/file"
+		if err := os.WriteFile(name, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := OpenLineReader(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for line, ok := r.ReadLine(); ok; line, ok = r.ReadLine() {
+			got = append(got, line)
+		}
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: got %d lines %.40q; want %d %.40q", i, len(got), got, len(tt.want), tt.want)
+		}
+		if err := r.Err(); err != tt.err {
+			t.Errorf("#%d: got error %v; want %v", i, err, tt.err)
+		}
+	}
+
+	if _, err := OpenLineReader("a-nonexistent-file"); !os.IsNotExist(err) {
+		t.Errorf("OpenLineReader of missing file: got error %v", err)
+	}
+}
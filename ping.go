@@ -0,0 +1,82 @@
+package dnsconfig
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// pingQuery is a DNS query for the NS records of the root zone, sent to
+// check that a server answers over UDP.
+var pingQuery = []byte{
+	0x00, 0x01, // ID
+	0x01, 0x00, // flags: recursion desired
+	0x00, 0x01, // QDCOUNT
+	0x00, 0x00, // ANCOUNT
+	0x00, 0x00, // NSCOUNT
+	0x00, 0x00, // ARCOUNT
+	0x00,       // QNAME: the root
+	0x00, 0x02, // QTYPE: NS
+	0x00, 0x01, // QCLASS: IN
+}
+
+// Ping checks that each of Servers is reachable and returns the result
+// for every server, nil meaning it is up. Over TCP, if UseTCP is set, a
+// server is up if it accepts a connection; over UDP, it must answer a
+// query, as a UDP connect alone proves nothing. Each check gives up
+// after Timeout, or earlier if ctx is done.
+func (conf *DnsConfig) Ping(ctx context.Context) map[string]error {
+	network := "udp"
+	if conf.UseTCP {
+		network = "tcp"
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error, len(conf.Servers))
+	)
+	for _, s := range conf.Servers {
+		wg.Add(1)
+		go func(s string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := ping(ctx, network, s)
+			mu.Lock()
+			results[s] = err
+			mu.Unlock()
+		}(s)
+	}
+	wg.Wait()
+	return results
+}
+
+func ping(ctx context.Context, network, addr string) error {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if network == "tcp" {
+		return nil
+	}
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+	defer stop()
+	if _, err := c.Write(pingQuery); err != nil {
+		return err
+	}
+	var buf [512]byte
+	if _, err := c.Read(buf[:]); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package dnsconfig
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// closedAddr returns the address of a port nothing listens on.
+func closedAddr(t *testing.T, network string) string {
+	t.Helper()
+	switch network {
+	case "tcp":
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln.Close()
+		return ln.Addr().String()
+	default:
+		c, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		return c.LocalAddr().String()
+	}
+}
+
+func TestPingTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	up, down := ln.Addr().String(), closedAddr(t, "tcp")
+
+	conf := &DnsConfig{Servers: []string{up, down}, Timeout: time.Second, UseTCP: true}
+	results := conf.Ping(context.Background())
+	if err := results[up]; err != nil {
+		t.Errorf("Ping(%s) = %v; want nil", up, err)
+	}
+	if err, ok := results[down]; !ok || err == nil {
+		t.Errorf("Ping(%s) = %v; want error", down, err)
+	}
+}
+
+func TestPingUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		var buf [512]byte
+		n, addr, err := pc.ReadFrom(buf[:])
+		if err != nil {
+			return
+		}
+		pc.WriteTo(buf[:n], addr)
+	}()
+	up, silent := pc.LocalAddr().String(), closedAddr(t, "udp")
+
+	conf := &DnsConfig{Servers: []string{up, silent}, Timeout: 500 * time.Millisecond}
+	results := conf.Ping(context.Background())
+	if err := results[up]; err != nil {
+		t.Errorf("Ping(%s) = %v; want nil", up, err)
+	}
+	if err, ok := results[silent]; !ok || err == nil {
+		t.Errorf("Ping(%s) = %v; want error", silent, err)
+	}
+}
+
+func TestPingCanceled(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	conf := &DnsConfig{Servers: []string{pc.LocalAddr().String()}, Timeout: time.Minute}
+	start := time.Now()
+	results := conf.Ping(ctx)
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Ping took %v after cancellation", d)
+	}
+	if err := results[pc.LocalAddr().String()]; err != context.Canceled {
+		t.Errorf("Ping = %v; want %v", err, context.Canceled)
+	}
+}
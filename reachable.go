@@ -0,0 +1,44 @@
+package dnsconfig
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+)
+
+// ErrRoutesUnsupported is returned by ReachableServers on platforms
+// where the routing table cannot be read.
+var ErrRoutesUnsupported = errors.New("dnsconfig: reading the routing table is not supported on this platform")
+
+// routeSource returns the destination prefixes of the usable routes in
+// the system routing table, a default route being 0.0.0.0/0 or ::/0.
+var routeSource = systemRoutes // variable for testing
+
+// ReachableServers returns the entries of Servers the routing table has
+// a route to, in order. Loopback servers are always reachable. If the
+// routing table cannot be read, it returns all of Servers along with
+// the error, which is ErrRoutesUnsupported on platforms other than
+// Linux.
+func (conf *DnsConfig) ReachableServers() ([]string, error) {
+	routes, err := routeSource()
+	if err != nil {
+		return slices.Clone(conf.Servers), err
+	}
+	var servers []string
+	for _, s := range conf.Servers {
+		host, _, err := net.SplitHostPort(s)
+		if err != nil {
+			continue
+		}
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			continue
+		}
+		ip = ip.WithZone("").Unmap()
+		if ip.IsLoopback() || slices.ContainsFunc(routes, func(p netip.Prefix) bool { return p.Contains(ip) }) {
+			servers = append(servers, s)
+		}
+	}
+	return servers, nil
+}
@@ -0,0 +1,46 @@
+package dnsconfig
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestReachableServers(t *testing.T) {
+	origRouteSource := routeSource
+	defer func() { routeSource = origRouteSource }()
+
+	conf := &DnsConfig{Servers: []string{
+		"10.1.2.3:53",
+		"192.168.1.1:53",
+		"127.0.0.53:53",
+		"[2001:db8::53]:53",
+		"[fd00::53]:53",
+		"[::ffff:10.9.9.9]:53",
+	}}
+	routeSource = func() ([]netip.Prefix, error) {
+		return []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("fd00::/64"),
+		}, nil
+	}
+	want := []string{"10.1.2.3:53", "127.0.0.53:53", "[fd00::53]:53", "[::ffff:10.9.9.9]:53"}
+	if got, err := conf.ReachableServers(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ReachableServers() = %q, %v; want %q, nil", got, err, want)
+	}
+
+	routeSource = func() ([]netip.Prefix, error) {
+		return []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}, nil
+	}
+	want = []string{"10.1.2.3:53", "192.168.1.1:53", "127.0.0.53:53", "[::ffff:10.9.9.9]:53"}
+	if got, err := conf.ReachableServers(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ReachableServers() with IPv4 default route = %q, %v; want %q, nil", got, err, want)
+	}
+
+	routeSource = func() ([]netip.Prefix, error) { return nil, ErrRoutesUnsupported }
+	got, err := conf.ReachableServers()
+	if !errors.Is(err, ErrRoutesUnsupported) || !reflect.DeepEqual(got, conf.Servers) {
+		t.Errorf("ReachableServers() without routes = %q, %v; want %q, %v", got, err, conf.Servers, ErrRoutesUnsupported)
+	}
+}
@@ -0,0 +1,28 @@
+package dnsconfig
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// ReloadOnSignal reads the config from path, as ReadDnsConfig with
+// WithFile does, each time the process receives sig, conventionally
+// SIGHUP, and passes it to onChange. The handler is installed before
+// ReloadOnSignal returns, and removed when ctx is done. onChange is
+// called from a single goroutine, one signal at a time.
+func ReloadOnSignal(ctx context.Context, path string, sig os.Signal, onChange func(*DnsConfig)) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig)
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-c:
+				onChange(ReadDnsConfig(WithFile(path)))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package dnsconfig
+
+import (
+	"context"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadOnSignal(t *testing.T) {
+	unsetNdotsEnv(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	confs := make(chan *DnsConfig, 1)
+	ReloadOnSignal(ctx, "testdata/crlf-resolv.conf", syscall.SIGUSR1, func(conf *DnsConfig) {
+		confs <- conf
+	})
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case conf := <-confs:
+		if want := []string{"8.8.8.8:53", "8.8.4.4:53"}; !reflect.DeepEqual(conf.Servers, want) {
+			t.Errorf("got servers %q; want %q", conf.Servers, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("onChange not called after signal")
+	}
+}
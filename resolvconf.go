@@ -0,0 +1,818 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Parse DNS config in resolv.conf format.
+
+package dnsconfig
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	// SplitCommaSeparatedServers makes a nameserver line list several
+	// comma-separated servers, as in "nameserver 8.8.8.8,8.8.4.4",
+	// as some non-standard tools write. libc ignores such lines.
+	SplitCommaSeparatedServers = false
+
+	// ParseServerPriorityComments orders name servers by a priority
+	// noted in a trailing comment, as in "nameserver 10.0.0.1 # priority=1".
+	// Servers with lower priorities come first, and those without a
+	// priority come last; servers of equal priority keep their order.
+	ParseServerPriorityComments = false
+
+	// PunycodeSearchDomains converts search domains written in Unicode,
+	// such as "münchen.example", to their ASCII form, as in
+	// "xn--mnchen-3ya.example", which is what name servers expect.
+	PunycodeSearchDomains = false
+
+	// AllowHostnameServers keeps nameserver entries that name a host
+	// rather than an IP address in DnsConfig.UnresolvedServers. They are
+	// not looked up, as that would need DNS; libc ignores them.
+	AllowHostnameServers = false
+
+	// AccumulateSearchLines appends the domains of each "search" line to
+	// those of the lines before it, up to the limit of six, rather than
+	// letting the last line win as libc does. A "domain" line still
+	// replaces the search list.
+	AccumulateSearchLines = false
+
+	// CaseInsensitiveDirectives accepts directives in any case, such
+	// as "Nameserver" and "SEARCH", as some generators write them. libc
+	// only accepts them in lower case. Options are still case-sensitive.
+	CaseInsensitiveDirectives = false
+
+	// RewriteUnspecifiedServers replaces the unspecified addresses
+	// 0.0.0.0 and :: in nameserver lines with the loopback addresses
+	// 127.0.0.1 and ::1, as libc does, since a query cannot be sent to
+	// the unspecified address.
+	RewriteUnspecifiedServers = true
+
+	// AllowIncludes reads the file named by an "include" directive, as
+	// in "include /etc/resolv.conf.d/corp", as if its lines took the
+	// place of the directive. A relative name is taken relative to the
+	// including file. libc has no such directive, so it is off by
+	// default and "include" is then an unknown directive.
+	AllowIncludes = false
+
+	// DnsmasqCompat also reads the name servers of dnsmasq "server="
+	// lines, as in "server=1.1.1.1" or "server=9.9.9.9#5353", so that a
+	// dnsmasq config can stand in for resolv.conf. Servers for only some
+	// domains, as in "server=/example.com/10.0.0.1", are skipped with a
+	// warning.
+	DnsmasqCompat = false
+
+	// MaxConfigBytes is the largest resolv.conf file that will be parsed,
+	// however it is read. Reading stops with ErrConfigTooLarge once more
+	// is read, even from a file that reports no size, such as a pipe.
+	MaxConfigBytes int64 = 64 << 10
+
+	// ErrConfigTooLarge is reported in DnsConfig.Err when the config file
+	// exceeds MaxConfigBytes.
+	ErrConfigTooLarge = errors.New("config too large")
+
+	// ErrInvalidUTF8 is reported in DnsConfig.Err when the config file
+	// is not valid UTF-8, as a binary or mis-encoded file is not.
+	ErrInvalidUTF8 = errors.New("config is not valid UTF-8")
+)
+
+// maxNameservers is the number of name servers kept by default: small,
+// but the standard limit.
+const maxNameservers = 3
+
+// ReadDnsConfigFS reads a resolv.conf file named name from fsys.
+func ReadDnsConfigFS(fsys fs.FS, name string) *DnsConfig {
+	o := defaultOptions()
+	o.fsys = fsys
+	return readConfig(name, o)
+}
+
+// ParseDnsConfig parses a config in resolv.conf format read from r.
+func ParseDnsConfig(r io.Reader) *DnsConfig {
+	o := defaultOptions()
+	o.reader = r
+	return readConfig("resolv.conf", o)
+}
+
+// ReadDnsConfigFromConn parses a config in resolv.conf format sent
+// over conn, such as a Unix socket to a local resolver's config API. It
+// reads until EOF, so the sender must close its end, or the caller set
+// a deadline on conn; a read error is reported in the config's Err.
+func ReadDnsConfigFromConn(conn io.Reader) *DnsConfig {
+	return ParseDnsConfig(conn)
+}
+
+// ParseDnsConfigBytes parses a config in resolv.conf format held in b.
+func ParseDnsConfigBytes(b []byte) *DnsConfig {
+	o := defaultOptions()
+	o.data = b
+	if o.data == nil {
+		o.data = []byte{}
+	}
+	return readConfig("resolv.conf", o)
+}
+
+func dnsReadConfig(filename string) *DnsConfig {
+	return readConfig(filename, defaultOptions())
+}
+
+// See resolv.conf(5) on a Linux machine.
+func readConfig(filename string, o *options) *DnsConfig {
+	maxServers := o.maxServers
+	if maxServers <= 0 {
+		maxServers = maxNameservers
+	}
+	stats := o.stats
+	if stats == nil {
+		stats = new(Stats)
+	}
+	conf := newConfig()
+	defer func() { stats.SearchCount = len(conf.Search) }()
+	var file *file
+	var path string // of the file opened, if any
+	var err error
+	switch {
+	case o.data != nil:
+		file = newFileBytes(o.data)
+	case o.reader != nil:
+		file = newFile(o.reader)
+	case o.fsys != nil:
+		path = filename
+		file, err = openFS(o.fsys, filename)
+	default:
+		if path, err = resolveSymlinks(filename); err == nil {
+			file, err = open(path)
+		}
+	}
+	if err != nil {
+		Logger.Debugf("dnsconfig: %v", err)
+		stats.FileExisted = !errors.Is(err, fs.ErrNotExist)
+		conf = defaultConfig()
+		conf.Err = err
+		if stats.FileExisted && o.fsys == nil {
+			// Record when the file last changed all the same, so that
+			// CachedConfig does not reread a file that still cannot be
+			// opened.
+			if fi, err := os.Stat(filename); err == nil {
+				conf.Mtime = fi.ModTime()
+			}
+		}
+		return conf
+	}
+	defer file.close()
+	file.setLimit(MaxConfigBytes)
+	stats.FileExisted = true
+	conf.ResolvedPath = path
+	Logger.Debugf("dnsconfig: reading %s", filename)
+	if f, ok := file.file.(fs.File); ok {
+		if fi, err := f.Stat(); err == nil {
+			if fi.Size() > MaxConfigBytes {
+				conf = defaultConfig()
+				conf.Mtime = fi.ModTime()
+				conf.ResolvedPath = path
+				conf.Err = &fs.PathError{Op: "read", Path: filename, Err: ErrConfigTooLarge}
+				return conf
+			}
+			conf.Mtime = fi.ModTime()
+		} else {
+			conf = defaultConfig()
+			conf.Err = err
+			return conf
+		}
+	}
+	r := &confReader{file: file, path: path, fsys: o.fsys}
+	r.warn = func(msg string) { conf.Warnings = append(conf.Warnings, msg) }
+	defer r.close()
+	servers := &serverList{conf: conf, max: maxServers, stats: stats, filename: filename}
+	var sawSearch bool // Search is from a "search" line, for AccumulateSearchLines
+	debug := debugging()
+	for f, comment, port, ok := r.next(); ok; f, comment, port, ok = r.next() {
+		switch directive(f[0]) {
+		case "nameserver": // add one name server
+			servers.add(f, comment, port)
+
+		// The domain and search directives both replace the search
+		// path, so whichever appears last wins, as in libc.
+		case "domain": // set search path to just this domain
+			if len(f) > 1 {
+				if name, ok := conf.asciiSearchDomain(f[1]); ok {
+					conf.Search = []string{ensureRooted(name)}
+					sawSearch = false
+				}
+			}
+
+		case "search": // set search path to given servers
+			if !AccumulateSearchLines || !sawSearch {
+				conf.Search = make([]string, 0, len(f)-1)
+			}
+			sawSearch = true
+			for i := 1; i < len(f); i++ {
+				name, ok := conf.asciiSearchDomain(f[i])
+				if !ok {
+					continue
+				}
+				name = ensureRooted(name)
+				if name == "." {
+					continue
+				}
+				if len(name) > 254 {
+					// Too long to ever form a valid name (see isDomainName).
+					conf.Warnings = append(conf.Warnings, "search domain too long, ignoring "+name)
+					continue
+				}
+				if len(conf.Search) == maxDNSSearch {
+					conf.Warnings = append(conf.Warnings, "too many search domains, ignoring "+name)
+					continue
+				}
+				conf.Search = append(conf.Search, name)
+			}
+
+		case "options": // magic options
+			for _, s := range joinOptionValues(f[1:]) {
+				if debug {
+					Logger.Debugf("dnsconfig: %s: option %q", filename, s)
+				}
+				switch {
+				case hasPrefix(s, "ndots:"):
+					v := s[6:]
+					if LibcFlavor == Musl && (v == "" || v[0] < '0' || v[0] > '9') {
+						// musl ignores a value that does not start
+						// with a digit, keeping the previous one.
+						break
+					}
+					var n int
+					if hasPrefix(v, "-") {
+						n, _, _ = dtoi(v[1:])
+						n = -n
+					} else {
+						n, _, _ = dtoi(v)
+					}
+					conf.Ndots = clampNdots(n)
+				case hasPrefix(s, "timeout:"):
+					n, _, _ := dtoi(s[8:])
+					if n < 1 {
+						n = 1
+					}
+					conf.Timeout = time.Duration(n) * time.Second
+				case hasPrefix(s, "attempts:") || hasPrefix(s, "retries:"):
+					// "retries" is a synonym some tools use.
+					_, v, _ := strings.Cut(s, ":")
+					n, _, _ := dtoi(v)
+					if n < 1 {
+						n = 1
+					}
+					conf.Attempts = n
+				case s == "rotate":
+					conf.Rotate = true
+				case s == "single-request" || s == "single-request-reopen":
+					// Linux option:
+					// http://man7.org/linux/man-pages/man5/resolv.conf.5.html
+					// "By default, glibc performs IPv4 and IPv6 lookups in parallel [...]
+					//  This option disables the behavior and makes glibc
+					//  perform the IPv6 and IPv4 requests sequentially."
+					conf.SingleRequest = true
+					if s == "single-request-reopen" {
+						// "[...] closes the socket and opens a new one
+						//  before sending the second request."
+						conf.SingleRequestReopen = true
+					}
+				case s == "use-vc" || s == "usevc" || s == "tcp":
+					// Linux (use-vc), FreeBSD (usevc) and OpenBSD (tcp) option:
+					// http://man7.org/linux/man-pages/man5/resolv.conf.5.html
+					// "Sets RES_USEVC in _res.options.
+					//  This option forces the use of TCP for DNS resolutions."
+					// https://www.freebsd.org/cgi/man.cgi?query=resolv.conf&sektion=5&manpath=freebsd-release-ports
+					// https://man.openbsd.org/resolv.conf.5
+					conf.UseTCP = true
+				case s == "trust-ad":
+					conf.TrustAD = true
+				case s == "no-trust-ad":
+					// Clears an earlier trust-ad; the last one wins.
+					conf.TrustAD = false
+				case s == "edns0":
+					// We use EDNS by default.
+					// Ignore this option.
+				case s == "no-reload":
+					conf.NoReload = true
+				case s == "insecure1":
+					// FreeBSD option:
+					// https://man.freebsd.org/cgi/man.cgi?query=resolver&sektion=3
+					// "Do not require the IP source address on the reply packet
+					//  to be equal to the server's address."
+					conf.Insecure1 = true
+				case s == "no-tld-query":
+					// NetBSD, DragonFly and glibc option:
+					// https://man.netbsd.org/resolv.conf.5
+					// "sets RES_NOTLDQUERY. This option causes
+					//  res_nsearch() to not attempt to resolve an
+					//  unqualified name as if it were a top level domain."
+					conf.NoTLDQuery = true
+				case s == "insecure2":
+					// FreeBSD option:
+					// "Do not check if the query section of the reply packet
+					//  is equal to that of the query packet."
+					conf.Insecure2 = true
+				default:
+					conf.UnknownOpt = true
+					conf.ExtraOptions = append(conf.ExtraOptions, s)
+					if key, value, ok := strings.Cut(s, ":"); ok {
+						if conf.ExtraOptionValues == nil {
+							conf.ExtraOptionValues = make(map[string]string)
+						}
+						conf.ExtraOptionValues[key] = value
+					}
+					stats.UnknownOptions++
+				}
+			}
+
+		case "lookup":
+			// OpenBSD option:
+			// https://www.openbsd.org/cgi-bin/man.cgi/OpenBSD-current/man5/resolv.conf.5
+			// "the legal space-separated values are: bind, file, yp"
+			conf.Lookup = slices.Clone(f[1:])
+
+		case "include":
+			if !AllowIncludes {
+				conf.UnknownOpt = true
+				stats.UnknownOptions++
+				break
+			}
+			if len(f) < 2 {
+				conf.Warnings = append(conf.Warnings, "include with no file name")
+				break
+			}
+			if err := r.include(f[1]); err != nil {
+				conf.Warnings = append(conf.Warnings, "cannot include "+strconv.Quote(f[1])+": "+err.Error())
+			}
+
+		default:
+			conf.UnknownOpt = true
+			stats.UnknownOptions++
+		}
+	}
+	if r.err != nil {
+		mtime := conf.Mtime
+		conf = defaultConfig()
+		conf.Mtime = mtime
+		conf.ResolvedPath = path
+		conf.Err = &fs.PathError{Op: "read", Path: filename, Err: r.err}
+		return conf
+	}
+	servers.done()
+	conf.setDefaults()
+	if o.nsswitch != "" {
+		lookup, err := ReadNSSwitch(o.nsswitch)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			conf.Warnings = append(conf.Warnings, "cannot read "+o.nsswitch+": "+err.Error())
+		}
+		conf.NSSwitch = lookup
+	}
+	return conf
+}
+
+// A confReader reads the lines of a resolv.conf file, and of the files
+// it includes, as fields.
+type confReader struct {
+	file     *file
+	path     string       // of file, if read from one
+	fsys     fs.FS        // holding the included files; nil means the OS
+	warn     func(string) // if non-nil, told of problems that do not stop reading
+	includes []include    // being read, innermost last
+	fields   []string     // reused for each line
+	line     int          // of file last read, counting from 1
+	err      error        // why reading stopped early, if it did
+}
+
+// warning passes msg to r.warn, if set.
+func (r *confReader) warning(msg string) {
+	if r.warn != nil {
+		r.warn(msg)
+	}
+}
+
+// close closes the included files still being read.
+func (r *confReader) close() {
+	for _, inc := range r.includes {
+		inc.file.close()
+	}
+}
+
+// readLine returns the next line of the innermost included file that
+// has one left, or else of the config file.
+func (r *confReader) readLine() (string, bool) {
+	for len(r.includes) > 0 {
+		inc := r.includes[len(r.includes)-1]
+		if line, ok := inc.file.readLine(); ok {
+			return line, true
+		}
+		if inc.file.err != nil {
+			r.warning("cannot read included " + inc.path + ": " + inc.file.err.Error())
+		}
+		inc.file.close()
+		r.includes = r.includes[:len(r.includes)-1]
+	}
+	line, ok := r.file.readLine()
+	if ok {
+		r.line++
+		if r.line == 1 {
+			// Skip a UTF-8 byte order mark left by Windows editors.
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+	}
+	return line, ok
+}
+
+// next returns the fields of the next line that is not blank or a
+// comment, with any trailing comment split off into comment, and the
+// port of the name servers it lists. With DnsmasqCompat, a dnsmasq
+// "server=" line is returned as the equivalent nameserver line. ok is
+// false at the end of the file, or if reading stopped early, as
+// recorded in r.err.
+func (r *confReader) next() (f, comment []string, port string, ok bool) {
+	for {
+		line, ok := r.readLine()
+		if !ok {
+			r.err = r.file.err
+			return nil, nil, "", false
+		}
+		if !utf8.ValidString(line) {
+			r.err = ErrInvalidUTF8
+			return nil, nil, "", false
+		}
+		r.fields = appendFields(r.fields[:0], line)
+		f = r.fields
+		if len(f) < 1 {
+			continue
+		}
+		if f[0][0] == ';' || f[0][0] == '#' {
+			// comment, possibly indented.
+			continue
+		}
+		comment = nil
+		for i := 1; i < len(f); i++ {
+			if f[i][0] == ';' || f[i][0] == '#' {
+				// trailing comment, as in "options ndots:2 # custom".
+				f, comment = f[:i], f[i:]
+				break
+			}
+		}
+		port = DefaultPort
+		if DnsmasqCompat && hasPrefix(f[0], "server=") {
+			addr, p, ok := dnsmasqServer(f[0][len("server="):])
+			if !ok {
+				r.warning("unsupported dnsmasq server " + strconv.Quote(f[0]))
+				continue
+			}
+			f, port = []string{"nameserver", addr}, p
+		}
+		return f, comment, port, true
+	}
+}
+
+// include starts reading the file named by an include directive, whose
+// lines come before the rest of the file holding the directive.
+func (r *confReader) include(name string) error {
+	inc, err := openInclude(r.fsys, name, r.path, r.includes)
+	if err != nil {
+		return err
+	}
+	r.includes = append(r.includes, inc)
+	return nil
+}
+
+// A serverList adds the name servers of nameserver lines to a config.
+type serverList struct {
+	conf       *DnsConfig
+	max        int // of conf.Servers
+	stats      *Stats
+	filename   string // for debug logging
+	priorities []int  // of conf.AllServers, if ParseServerPriorityComments
+
+	// report, if non-nil, is told of each problem with the servers,
+	// for Lint.
+	report func(sev Severity, format string, args ...any)
+	full   bool // a server has been dropped by the limit
+}
+
+// lint passes a problem to l.report, if set.
+func (l *serverList) lint(sev Severity, format string, args ...any) {
+	if l.report != nil {
+		l.report(sev, format, args...)
+	}
+}
+
+// add adds the name servers of the nameserver line with fields f and
+// trailing comment comment, giving them port. Each line adds to the
+// servers, which are kept in file order up to the limit, however the
+// lines are interleaved with other directives.
+func (l *serverList) add(f, comment []string, port string) {
+	conf := l.conf
+	if len(f) > 1 && strings.IndexByte(f[1], '#') >= 0 {
+		// DNS-over-TLS server annotated with the name
+		// to verify, as in "1.1.1.1#cloudflare-dns.com".
+		if s, ok := dotServer(f[1]); ok {
+			conf.DoTServers = append(conf.DoTServers, s)
+		} else {
+			conf.Warnings = append(conf.Warnings, "invalid DNS-over-TLS nameserver "+strconv.Quote(f[1]))
+			l.lint(SeverityError, "invalid DNS-over-TLS nameserver %q", f[1])
+		}
+		return
+	}
+	if len(f) < 2 {
+		l.lint(SeverityError, "nameserver without an address")
+		return
+	}
+	addrs := f[1:2]
+	if SplitCommaSeparatedServers {
+		addrs = splitAtBytes(f[1], ",")
+	}
+	for _, addr := range addrs {
+		// One more check: make sure server name is
+		// just an IP address. Otherwise we need DNS
+		// to look it up.
+		ip, err := netip.ParseAddr(addr)
+		if err != nil && AllowHostnameServers && IsDomainName(addr) {
+			conf.UnresolvedServers = append(conf.UnresolvedServers, addr)
+			continue
+		}
+		if err != nil {
+			l.stats.ServersSkipped++
+			conf.Warnings = append(conf.Warnings, "invalid nameserver "+strconv.Quote(addr))
+			l.lint(SeverityError, "invalid nameserver address %q", addr)
+			Logger.Debugf("dnsconfig: %s: skipping nameserver %q: not an IP address", l.filename, addr)
+			continue
+		}
+		// Store the canonical form, so that "2001:DB8:0::1"
+		// and "2001:db8::1" name the same server.
+		server := net.JoinHostPort(rewriteUnspecified(ip).String(), port)
+		if slices.Contains(conf.AllServers, server) {
+			l.lint(SeverityWarning, "duplicate nameserver %s", addr)
+		}
+		conf.AllServers = append(conf.AllServers, server)
+		if ParseServerPriorityComments {
+			l.priorities = append(l.priorities, commentPriority(comment))
+		}
+		if slices.Contains(conf.Servers, server) {
+			// A repeated server does not take up a slot.
+			continue
+		}
+		if len(conf.Servers) >= l.max {
+			if !l.full {
+				l.lint(SeverityWarning, "too many nameservers; only the first %d are used", l.max)
+				l.full = true
+			}
+			l.stats.ServersSkipped++
+			if debugging() {
+				Logger.Debugf("dnsconfig: %s: skipping nameserver %q: limit of %d reached", l.filename, addr, l.max)
+			}
+			continue
+		}
+		conf.Servers = append(conf.Servers, server)
+		l.stats.ServersFound++
+	}
+}
+
+// done orders the servers by their priority comments, if
+// ParseServerPriorityComments is set.
+func (l *serverList) done() {
+	if ParseServerPriorityComments && len(l.conf.AllServers) > 0 {
+		sortServersByPriority(l.conf.AllServers, l.priorities)
+		l.conf.Servers = distinctServers(l.conf.AllServers, len(l.conf.Servers))
+	}
+}
+
+// distinctServers returns the first n distinct servers of all.
+func distinctServers(all []string, n int) []string {
+	var servers []string
+	for _, s := range all {
+		if len(servers) == n {
+			break
+		}
+		if !slices.Contains(servers, s) {
+			servers = append(servers, s)
+		}
+	}
+	return servers
+}
+
+// dnsmasqServer returns the address and port of the server named by
+// the value of a dnsmasq "server=" line, such as "9.9.9.9#5353@eth0",
+// ignoring any source address or interface after the '@'. ok is false
+// for a server of only some domains.
+func dnsmasqServer(v string) (addr, port string, ok bool) {
+	if v == "" || v[0] == '/' {
+		return "", "", false
+	}
+	v, _, _ = strings.Cut(v, "@")
+	addr, port, found := strings.Cut(v, "#")
+	if !found {
+		return addr, DefaultPort, true
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", "", false
+	}
+	return addr, port, true
+}
+
+// An include is a file being read for an include directive.
+type include struct {
+	file *file
+	path string // as opened, after following symbolic links
+}
+
+// maxIncludeDepth bounds the nesting of include directives.
+const maxIncludeDepth = 8
+
+var (
+	errIncludeLoop  = errors.New("file is already being read")
+	errIncludeDepth = errors.New("includes nested too deeply")
+)
+
+// openInclude opens the file named by an include directive. A relative
+// name is taken relative to the directory of the file holding the
+// directive: the innermost of includes, or else top, the path of the
+// config file, which is empty if it was not read from a file. Files
+// are opened from fsys if it is non-nil. A file already being read is
+// refused, to break include loops.
+func openInclude(fsys fs.FS, name, top string, includes []include) (include, error) {
+	if len(includes) >= maxIncludeDepth {
+		return include{}, errIncludeDepth
+	}
+	parent := top
+	if len(includes) > 0 {
+		parent = includes[len(includes)-1].path
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(parent), name)
+	}
+	var inc include
+	var err error
+	if fsys != nil {
+		inc.path = filepath.ToSlash(filepath.Clean(name))
+	} else if inc.path, err = resolveSymlinks(name); err != nil {
+		return include{}, err
+	}
+	same := func(p string) bool {
+		if fsys != nil {
+			return p == inc.path
+		}
+		a, err1 := filepath.Abs(p)
+		b, err2 := filepath.Abs(inc.path)
+		return err1 == nil && err2 == nil && a == b
+	}
+	if top != "" && same(top) || slices.ContainsFunc(includes, func(i include) bool { return same(i.path) }) {
+		return include{}, errIncludeLoop
+	}
+	if fsys != nil {
+		inc.file, err = openFS(fsys, inc.path)
+	} else {
+		inc.file, err = open(inc.path)
+	}
+	if err != nil {
+		return include{}, err
+	}
+	inc.file.setLimit(MaxConfigBytes)
+	return inc, nil
+}
+
+// rewriteUnspecified returns the loopback address of ip's family in
+// place of an unspecified ip, if RewriteUnspecifiedServers is set.
+func rewriteUnspecified(ip netip.Addr) netip.Addr {
+	switch {
+	case !RewriteUnspecifiedServers || !ip.IsUnspecified():
+		return ip
+	case ip.Is4():
+		return netip.AddrFrom4([4]byte{127, 0, 0, 1})
+	default:
+		return netip.IPv6Loopback()
+	}
+}
+
+// directive returns the directive named by the first field of a line,
+// lower-cased if CaseInsensitiveDirectives is set.
+func directive(s string) string {
+	if CaseInsensitiveDirectives {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// joinOptionValues rejoins numeric options written with a space after
+// the colon, as in "ndots: 5", which some tools write. libc would take
+// such an option to have no value.
+func joinOptionValues(opts []string) []string {
+	var joined []string
+	for i := 0; i < len(opts); i++ {
+		s := opts[i]
+		if (s == "ndots:" || s == "timeout:" || s == "attempts:" || s == "retries:") && i+1 < len(opts) {
+			if _, _, ok := dtoi(strings.TrimPrefix(opts[i+1], "-")); ok {
+				if joined == nil {
+					joined = append(make([]string, 0, len(opts)), opts[:i]...)
+				}
+				joined = append(joined, s+opts[i+1])
+				i++
+				continue
+			}
+		}
+		if joined != nil {
+			joined = append(joined, s)
+		}
+	}
+	if joined == nil {
+		return opts
+	}
+	return joined
+}
+
+// asciiSearchDomain returns name in ASCII form if PunycodeSearchDomains
+// is set. It reports false, noting a warning, if name is not a valid
+// internationalized domain name.
+func (conf *DnsConfig) asciiSearchDomain(name string) (string, bool) {
+	if !PunycodeSearchDomains || isASCII(name) {
+		return name, true
+	}
+	a, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		conf.Warnings = append(conf.Warnings, "invalid internationalized search domain "+strconv.Quote(name))
+		return "", false
+	}
+	return a, true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// commentPriority returns the priority noted as "priority=N" in the
+// trailing comment fields of a nameserver line, or math.MaxInt if there
+// is none.
+func commentPriority(comment []string) int {
+	for _, s := range comment {
+		s = strings.TrimLeft(s, "#;")
+		if v, ok := strings.CutPrefix(s, "priority="); ok {
+			if n, i, ok := dtoi(v); ok && i == len(v) {
+				return n
+			}
+		}
+	}
+	return math.MaxInt
+}
+
+// sortServersByPriority stably sorts servers by ascending priority,
+// where priorities[i] is the priority of servers[i].
+func sortServersByPriority(servers []string, priorities []int) {
+	type server struct {
+		addr     string
+		priority int
+	}
+	sorted := make([]server, len(servers))
+	for i, s := range servers {
+		sorted[i] = server{s, priorities[i]}
+	}
+	slices.SortStableFunc(sorted, func(a, b server) int {
+		return cmp.Compare(a.priority, b.priority)
+	})
+	for i, s := range sorted {
+		servers[i] = s.addr
+	}
+}
+
+// dotServer parses a nameserver token of the form "addr#servername"
+// and returns it in host:port#servername form using the DNS-over-TLS port.
+func dotServer(s string) (string, bool) {
+	i := strings.IndexByte(s, '#')
+	addr, name := s[:i], s[i+1:]
+	if name == "" {
+		return "", false
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return "", false
+	}
+	return net.JoinHostPort(rewriteUnspecified(ip).String(), "853") + "#" + name, true
+}
+
+func hasPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
+}
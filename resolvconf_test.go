@@ -0,0 +1,107 @@
+package dnsconfig
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
+)
+
+func TestReadDnsConfigFS(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() { getHostname = origGetHostname }()
+	getHostname = func() (string, error) { return "host.domain.local", nil }
+
+	mtime := time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"etc/resolv.conf": &fstest.MapFile{
+			Data:    []byte("nameserver 8.8.8.8\nsearch example.com\noptions ndots:2\n"),
+			ModTime: mtime,
+		},
+	}
+	conf := ReadDnsConfigFS(fsys, "etc/resolv.conf")
+	want := &DnsConfig{
+		Servers:      []string{"8.8.8.8:53"},
+		AllServers:   []string{"8.8.8.8:53"},
+		Search:       []string{"example.com."},
+		Ndots:        2,
+		Timeout:      5 * time.Second,
+		Attempts:     2,
+		Mtime:        mtime,
+		ResolvedPath: "etc/resolv.conf",
+	}
+	if !reflect.DeepEqual(conf, want) {
+		t.Errorf("got: %+v\nwant: %+v", conf, want)
+	}
+
+	conf = ReadDnsConfigFS(fsys, "etc/missing.conf")
+	if !errors.Is(conf.Err, fs.ErrNotExist) {
+		t.Errorf("missing file: got error %v; want %v", conf.Err, fs.ErrNotExist)
+	}
+}
+
+func TestReadDnsConfigFromConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		io.WriteString(server, "nameserver 8.8.8.8\nsearch example.com\n")
+	}()
+	conf := ReadDnsConfigFromConn(client)
+	if conf.Err != nil {
+		t.Fatal(conf.Err)
+	}
+	if want := []string{"8.8.8.8:53"}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("got servers %q; want %q", conf.Servers, want)
+	}
+	if want := []string{"example.com."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("got search %q; want %q", conf.Search, want)
+	}
+
+	// The sender never closes its end.
+	client, server = net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	client.SetReadDeadline(time.Now().Add(-time.Second))
+	if conf := ReadDnsConfigFromConn(client); conf.Err == nil {
+		t.Error("reading from a timed-out conn: got no error")
+	}
+}
+
+func TestMaxConfigBytesReader(t *testing.T) {
+	data := []byte("nameserver 8.8.8.8\n" + strings.Repeat("# padding\n", 18000))
+	if int64(len(data)) <= MaxConfigBytes {
+		t.Fatalf("test config of %d bytes is not over the limit", len(data))
+	}
+	for _, conf := range []*DnsConfig{
+		ParseDnsConfig(bytes.NewReader(data)),
+		ParseDnsConfig(iotest.OneByteReader(bytes.NewReader(data))),
+		ParseDnsConfigBytes(data),
+	} {
+		if !errors.Is(conf.Err, ErrConfigTooLarge) {
+			t.Errorf("got error %v; want %v", conf.Err, ErrConfigTooLarge)
+		}
+		if !reflect.DeepEqual(conf.Servers, defaultNS) {
+			t.Errorf("got servers %q; want the defaults", conf.Servers)
+		}
+	}
+
+	if conf := ParseDnsConfig(bytes.NewReader(data[:MaxConfigBytes])); conf.Err != nil {
+		t.Errorf("config of MaxConfigBytes: got error %v", conf.Err)
+	}
+}
+
+func TestDoTServerCanonical(t *testing.T) {
+	conf := ParseDnsConfigBytes([]byte("nameserver 2001:DB8:0::1#x.example\nnameserver 0.0.0.0#y.example\n"))
+	want := []string{"[2001:db8::1]:853#x.example", "127.0.0.1:853#y.example"}
+	if !reflect.DeepEqual(conf.DoTServers, want) {
+		t.Errorf("got DoT servers %q; want %q", conf.DoTServers, want)
+	}
+}
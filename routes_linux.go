@@ -0,0 +1,105 @@
+package dnsconfig
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Route flags, from <linux/route.h>.
+const (
+	rtfUp     = 0x1
+	rtfReject = 0x200
+)
+
+// systemRoutes reads the main routing table from /proc.
+func systemRoutes() ([]netip.Prefix, error) {
+	var routes []netip.Prefix
+	for _, t := range []struct {
+		name  string
+		parse func(io.Reader) ([]netip.Prefix, error)
+	}{
+		{"/proc/net/route", parseIPv4Routes},
+		{"/proc/net/ipv6_route", parseIPv6Routes},
+	} {
+		f, err := os.Open(t.name)
+		if err != nil {
+			if os.IsNotExist(err) && t.name == "/proc/net/ipv6_route" {
+				// IPv6 is disabled.
+				continue
+			}
+			return nil, err
+		}
+		r, err := t.parse(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, r...)
+	}
+	return routes, nil
+}
+
+// parseIPv4Routes parses routes in the format of /proc/net/route, a
+// header line followed by lines of the form
+//
+//	eth0	000200C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+//
+// giving the interface, destination, gateway, flags, reference count,
+// use count, metric and mask, the addresses as little-endian hex.
+func parseIPv4Routes(r io.Reader) ([]netip.Prefix, error) {
+	var routes []netip.Prefix
+	s := bufio.NewScanner(r)
+	s.Scan() // skip the header
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) < 8 {
+			continue
+		}
+		dst, err1 := strconv.ParseUint(f[1], 16, 32)
+		flags, err2 := strconv.ParseUint(f[3], 16, 32)
+		mask, err3 := strconv.ParseUint(f[7], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		var a, m [4]byte
+		binary.LittleEndian.PutUint32(a[:], uint32(dst))
+		binary.LittleEndian.PutUint32(m[:], uint32(mask))
+		bits, _ := net.IPMask(m[:]).Size()
+		if p, err := netip.AddrFrom4(a).Prefix(bits); err == nil {
+			routes = append(routes, p)
+		}
+	}
+	return routes, s.Err()
+}
+
+// parseIPv6Routes parses routes in the format of /proc/net/ipv6_route,
+// lines giving the destination and its prefix length, source and its
+// prefix length, next hop, metric, reference count, use count, flags
+// and interface, all but the last in hex.
+func parseIPv6Routes(r io.Reader) ([]netip.Prefix, error) {
+	var routes []netip.Prefix
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) < 9 {
+			continue
+		}
+		dst, err1 := hex.DecodeString(f[0])
+		bits, err2 := strconv.ParseUint(f[1], 16, 8)
+		flags, err3 := strconv.ParseUint(f[8], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || len(dst) != 16 || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		if p, err := netip.AddrFrom16([16]byte(dst)).Prefix(int(bits)); err == nil {
+			routes = append(routes, p)
+		}
+	}
+	return routes, s.Err()
+}
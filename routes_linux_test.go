@@ -0,0 +1,29 @@
+package dnsconfig
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRoutes(t *testing.T) {
+	v4 := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+		"eth0\t00000000\t010200C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n" +
+		"eth0\t000200C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+		"eth1\t0000000A\t00000000\t0000\t0\t0\t0\t000000FF\t0\t0\t0\n"
+	got, err := parseIPv4Routes(strings.NewReader(v4))
+	want := []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("192.0.2.0/24")}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIPv4Routes() = %v, %v; want %v", got, err, want)
+	}
+
+	v6 := "fd000000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0\n" +
+		"00000000000000000000000000000001 80 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000002 00000000 80200001       lo\n" +
+		"00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo\n"
+	got, err = parseIPv6Routes(strings.NewReader(v6))
+	want = []netip.Prefix{netip.MustParsePrefix("fd00::/64"), netip.MustParsePrefix("::1/128")}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIPv6Routes() = %v, %v; want %v", got, err, want)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package dnsconfig
+
+import "net/netip"
+
+func systemRoutes() ([]netip.Prefix, error) {
+	return nil, ErrRoutesUnsupported
+}
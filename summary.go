@@ -0,0 +1,45 @@
+package dnsconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Summary returns a multi-line report of conf for people to read: the
+// servers, noting whether they are the fallback defaults, the search
+// list, the ndots, timeout and attempts settings, the options that are
+// set, and any error and warnings. The format may change between
+// releases.
+func (conf *DnsConfig) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "servers: %d", len(conf.Servers))
+	if conf.fallbackServers {
+		b.WriteString(" (defaults, none configured)")
+	}
+	b.WriteString("\n")
+	for _, s := range conf.Servers {
+		fmt.Fprintf(&b, "  %s\n", s)
+	}
+	if len(conf.Search) > 0 {
+		fmt.Fprintf(&b, "search: %s\n", strings.Join(conf.Search, " "))
+	} else {
+		b.WriteString("search: none\n")
+	}
+	fmt.Fprintf(&b, "ndots: %d, timeout: %v, attempts: %d\n", conf.Ndots, conf.Timeout, conf.Attempts)
+	var opts []string
+	for _, f := range conf.flags() {
+		if *f.on {
+			opts = append(opts, f.name)
+		}
+	}
+	if opts = sortOptions(append(opts, conf.ExtraOptions...)); len(opts) > 0 {
+		fmt.Fprintf(&b, "options: %s\n", strings.Join(opts, " "))
+	}
+	if conf.Err != nil {
+		fmt.Fprintf(&b, "error: %v\n", conf.Err)
+	}
+	for _, w := range conf.Warnings {
+		fmt.Fprintf(&b, "warning: %s\n", w)
+	}
+	return b.String()
+}
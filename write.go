@@ -0,0 +1,118 @@
+package dnsconfig
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteTo writes conf to w in resolv.conf format. Options that have
+// their default values are omitted, and the rest, ExtraOptions
+// included, are written sorted by name, so that equal configs are
+// written identically however they were built.
+func (conf *DnsConfig) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	for _, s := range conf.Servers {
+		b.WriteString("nameserver " + serverHost(s) + "\n")
+	}
+	for _, s := range conf.DoTServers {
+		addr, name, _ := strings.Cut(s, "#")
+		b.WriteString("nameserver " + serverHost(addr) + "#" + name + "\n")
+	}
+	if len(conf.Search) > 0 {
+		b.WriteString("search " + strings.Join(conf.Search, " ") + "\n")
+	} else if conf.Search != nil {
+		// An explicitly empty search list.
+		b.WriteString("search .\n")
+	}
+	if len(conf.Lookup) > 0 {
+		b.WriteString("lookup " + strings.Join(conf.Lookup, " ") + "\n")
+	}
+	if opts := conf.options(); len(opts) > 0 {
+		b.WriteString("options " + strings.Join(opts, " ") + "\n")
+	}
+	return b.WriteTo(w)
+}
+
+// WriteFileAtomic writes conf, as WriteTo does, to the file at path
+// with permissions perm. It writes a temporary file in the same
+// directory, syncs it and renames it over path, so that a crash or a
+// failed write never leaves path partly written.
+func (conf *DnsConfig) WriteFileAtomic(path string, perm os.FileMode) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := conf.WriteTo(f); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := syncFile(f); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+var syncFile = (*os.File).Sync // variable for testing
+
+// options returns the "options" tokens describing conf, sorted by name.
+func (conf *DnsConfig) options() []string {
+	var opts []string
+	if conf.Ndots != 1 {
+		opts = append(opts, "ndots:"+strconv.Itoa(conf.Ndots))
+	}
+	if conf.Timeout != 5*time.Second {
+		opts = append(opts, "timeout:"+strconv.Itoa(int(conf.Timeout/time.Second)))
+	}
+	if conf.Attempts != 2 {
+		opts = append(opts, "attempts:"+strconv.Itoa(conf.Attempts))
+	}
+	for _, f := range conf.flags() {
+		if *f.on {
+			opts = append(opts, f.name)
+		}
+	}
+	return sortOptions(append(opts, conf.ExtraOptions...))
+}
+
+// sortOptions returns a copy of opts sorted by option name. Options of
+// the same name keep their order, as the last one takes effect.
+func sortOptions(opts []string) []string {
+	sorted := slices.Clone(opts)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		return strings.Compare(optionName(a), optionName(b))
+	})
+	return sorted
+}
+
+// optionName returns the name of an option token, as "ndots" for "ndots:2".
+func optionName(opt string) string {
+	name, _, _ := strings.Cut(opt, ":")
+	return name
+}
+
+// serverHost returns the host part of a host:port server address.
+// resolv.conf has no syntax for a port, so it is dropped.
+func serverHost(s string) string {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+package dnsconfig
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+var interfaceByName = net.InterfaceByName // variable for testing
+
+// ResolveZones rewrites the zone of each link-local server address from
+// an interface name to its numeric index, as in "[fe80::1%eth0]:53" to
+// "[fe80::1%2]:53". Servers without a zone, or whose zone is already
+// numeric, are left untouched. A zone that does not name an interface is
+// left as is, noted in Warnings and reported in the returned error.
+func (conf *DnsConfig) ResolveZones() error {
+	var errs []error
+	servers := make([]string, len(conf.Servers))
+	for i, s := range conf.Servers {
+		servers[i] = s
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			continue
+		}
+		ip, err := netip.ParseAddr(host)
+		if err != nil || ip.Zone() == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(ip.Zone()); err == nil {
+			continue
+		}
+		ifi, err := interfaceByName(ip.Zone())
+		if err != nil {
+			conf.Warnings = append(conf.Warnings, "cannot resolve zone of nameserver "+s)
+			errs = append(errs, fmt.Errorf("dnsconfig: resolving zone of %s: %w", s, err))
+			continue
+		}
+		servers[i] = net.JoinHostPort(ip.WithZone(strconv.Itoa(ifi.Index)).String(), port)
+	}
+	conf.Servers = servers
+	return errors.Join(errs...)
+}
@@ -0,0 +1,34 @@
+package dnsconfig
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestResolveZones(t *testing.T) {
+	origInterfaceByName := interfaceByName
+	defer func() { interfaceByName = origInterfaceByName }()
+	interfaceByName = func(name string) (*net.Interface, error) {
+		if name == "eth0" {
+			return &net.Interface{Index: 2, Name: name}, nil
+		}
+		return nil, errors.New("no such network interface")
+	}
+
+	conf := &DnsConfig{
+		Servers: []string{"8.8.8.8:53", "[fe80::1%eth0]:53", "[fe80::2%3]:53", "[fe80::3%bogus0]:53"},
+	}
+	err := conf.ResolveZones()
+	if err == nil {
+		t.Error("ResolveZones succeeded with an unknown interface")
+	}
+	want := []string{"8.8.8.8:53", "[fe80::1%2]:53", "[fe80::2%3]:53", "[fe80::3%bogus0]:53"}
+	if !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("Servers = %q; want %q", conf.Servers, want)
+	}
+	if len(conf.Warnings) != 1 {
+		t.Errorf("Warnings = %q; want one warning", conf.Warnings)
+	}
+}